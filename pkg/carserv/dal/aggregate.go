@@ -0,0 +1,182 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Metrics of an aggregation
+const (
+	MetricCount               = "count"
+	MetricSumVehicles         = "sum_vehicles"
+	MetricMinPrice            = "min_price"
+	MetricMaxPrice            = "max_price"
+	MetricAvgPrice            = "avg_price"
+	MetricMedianPrice         = "median_price"
+	MetricWeightedAvgPrice    = "weighted_avg_price"
+	MetricWeightedMedianPrice = "weighted_median_price"
+)
+
+// metrics computes each metric over the cars of a group, ordered by price
+var metrics = map[string]func(cars []Car, group []int) interface{}{
+	MetricCount: func(cars []Car, group []int) interface{} {
+		return len(group)
+	},
+	MetricSumVehicles: func(cars []Car, group []int) interface{} {
+		var sum int
+		for _, i := range group {
+			sum += cars[i].VehicleCount
+		}
+		return sum
+	},
+	MetricMinPrice: func(cars []Car, group []int) interface{} {
+		return cars[group[0]].Price
+	},
+	MetricMaxPrice: func(cars []Car, group []int) interface{} {
+		return cars[group[len(group)-1]].Price
+	},
+	MetricAvgPrice: func(cars []Car, group []int) interface{} {
+		var sum float64
+		for _, i := range group {
+			sum += float64(cars[i].Price)
+		}
+		return sum / float64(len(group))
+	},
+	MetricMedianPrice: func(cars []Car, group []int) interface{} {
+		return cars[group[len(group)/2]].Price
+	},
+	MetricWeightedAvgPrice: func(cars []Car, group []int) interface{} {
+		return WeightedPriceStats(cars, group).Mean
+	},
+	MetricWeightedMedianPrice: func(cars []Car, group []int) interface{} {
+		return WeightedPriceStats(cars, group).Median
+	},
+}
+
+// groupFields returns the value of each field cars can be grouped by
+var groupFields = map[string]func(car Car) interface{}{
+	fieldMake:  func(car Car) interface{} { return car.Make },
+	fieldModel: func(car Car) interface{} { return car.Model },
+	fieldYear:  func(car Car) interface{} { return car.Year },
+}
+
+// Aggregation defines a report computing metrics over the cars sharing the
+// values of the GroupBy fields, over every car when GroupBy is empty
+type Aggregation struct {
+	GroupBy []string
+	Metrics []string
+}
+
+// Table defines the result of an aggregation, a row per group holding the
+// values of the GroupBy fields followed by the metrics, in Columns order
+type Table struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ParseAggregation validates the comma separated group fields and metrics
+// of a user supplied aggregation. Metrics are required, fields may repeat
+// neither in groupBy nor in metrics.
+func ParseAggregation(groupBy, metricNames string) (Aggregation, error) {
+	var a Aggregation
+	seen := make(map[string]bool)
+	for _, field := range splitList(groupBy) {
+		if groupFields[field] == nil {
+			return a, fmt.Errorf("unknown group field: %s", field)
+		}
+		if seen[field] {
+			return a, fmt.Errorf("duplicate group field: %s", field)
+		}
+		seen[field] = true
+		a.GroupBy = append(a.GroupBy, field)
+	}
+	for _, metric := range splitList(metricNames) {
+		if metrics[metric] == nil {
+			return a, fmt.Errorf("unknown metric: %s", metric)
+		}
+		if seen[metric] {
+			return a, fmt.Errorf("duplicate metric: %s", metric)
+		}
+		seen[metric] = true
+		a.Metrics = append(a.Metrics, metric)
+	}
+	if len(a.Metrics) == 0 {
+		return a, errors.New("no metric given")
+	}
+	return a, nil
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Run computes the aggregation over the cars at positions, which must be
+// ordered by price. Rows are ordered by group values, groups without cars
+// are left out. It stops with the error of ctx once ctx is done.
+func (a Aggregation) Run(ctx context.Context, cars []Car, positions []int) (Table, error) {
+	table := Table{Columns: append(append([]string(nil), a.GroupBy...), a.Metrics...), Rows: [][]interface{}{}}
+
+	done := ctx.Done()
+	groups := make(map[string][]int)
+	var keys [][]interface{}
+	for _, i := range positions {
+		select {
+		case <-done:
+			return Table{}, ctx.Err()
+		default:
+		}
+		key := make([]interface{}, len(a.GroupBy))
+		for k, field := range a.GroupBy {
+			key[k] = groupFields[field](cars[i])
+		}
+		id := fmt.Sprintf("%#v", key)
+		if _, ok := groups[id]; !ok {
+			keys = append(keys, key)
+		}
+		groups[id] = append(groups[id], i)
+	}
+	sort.Slice(keys, func(x, y int) bool {
+		return lessKey(keys[x], keys[y])
+	})
+
+	for _, key := range keys {
+		select {
+		case <-done:
+			return Table{}, ctx.Err()
+		default:
+		}
+		group := groups[fmt.Sprintf("%#v", key)]
+		row := key
+		for _, metric := range a.Metrics {
+			row = append(row, metrics[metric](cars, group))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// lessKey orders group keys field by field
+func lessKey(a, b []interface{}) bool {
+	for k := range a {
+		switch x := a[k].(type) {
+		case string:
+			if y := b[k].(string); x != y {
+				return x < y
+			}
+		case int:
+			if y := b[k].(int); x != y {
+				return x < y
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAggregationRun(t *testing.T) {
+	cars := []Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+		{Make: "Ford", Model: "Transit Van", Year: 2020, VehicleCount: 4, Price: 42000},
+		{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+		{Make: "Ford", Model: "Focus", Year: 2019, VehicleCount: 2, Price: 15000},
+	}
+	byPrice := NewIndex(cars).ByPrice()
+
+	tests := []struct {
+		name     string
+		groupBy  string
+		metrics  string
+		expected Table
+	}{
+		{
+			name:    "Year",
+			groupBy: "year",
+			metrics: "count, sum_vehicles, min_price, max_price, median_price, weighted_median_price",
+			expected: Table{
+				Columns: []string{"year", "count", "sum_vehicles", "min_price", "max_price", "median_price", "weighted_median_price"},
+				Rows: [][]interface{}{
+					{2019, 3, 19, float32(15000), float32(30000), float32(21000), float32(30000)},
+					{2020, 1, 4, float32(42000), float32(42000), float32(42000), float32(42000)},
+				},
+			},
+		},
+		{
+			name:    "MakeYear",
+			groupBy: "make,year",
+			metrics: "avg_price,weighted_avg_price",
+			expected: Table{
+				Columns: []string{"make", "year", "avg_price", "weighted_avg_price"},
+				Rows: [][]interface{}{
+					{"Ford", 2019, 22500.0, 27500.0},
+					{"Ford", 2020, 42000.0, 42000.0},
+					{"Honda", 2019, 21000.0, 21000.0},
+				},
+			},
+		},
+		{
+			name:    "Ungrouped",
+			metrics: "count",
+			expected: Table{
+				Columns: []string{"count"},
+				Rows:    [][]interface{}{{4}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			aggregation, err := ParseAggregation(tc.groupBy, tc.metrics)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table, err := aggregation.Run(context.Background(), cars, byPrice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(table, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, table)
+			}
+		})
+	}
+}
+
+func TestAggregationRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	aggregation, err := ParseAggregation("make", MetricCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cars := []Car{{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000}}
+	if _, err := aggregation.Run(ctx, cars, []int{0}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %v, Got: %v", context.Canceled, err)
+	}
+}
+
+func TestParseAggregationErrors(t *testing.T) {
+	tests := []struct {
+		groupBy  string
+		metrics  string
+		expected string
+	}{
+		{groupBy: "colour", metrics: "count", expected: "unknown group field: colour"},
+		{groupBy: "make,make", metrics: "count", expected: "duplicate group field: make"},
+		{groupBy: "make", metrics: "count,mode_price", expected: "unknown metric: mode_price"},
+		{groupBy: "make", expected: "no metric given"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expected, func(t *testing.T) {
+			_, err := ParseAggregation(tc.groupBy, tc.metrics)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package dal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Kinds of aliases
+const (
+	AliasMakes  = "makes"
+	AliasModels = "models"
+)
+
+// ErrAliasNotFound is returned when an alias does not exist in a catalog
+var ErrAliasNotFound = errors.New("alias not found")
+
+// Aliases defines the canonical make or model each alias stands for
+type Aliases struct {
+	Makes  map[string]string `json:"makes"`
+	Models map[string]string `json:"models"`
+}
+
+// kind returns the aliases of a kind
+func (a Aliases) kind(kind string) (map[string]string, error) {
+	switch kind {
+	case AliasMakes:
+		return a.Makes, nil
+	case AliasModels:
+		return a.Models, nil
+	}
+	return nil, fmt.Errorf("unknown alias kind: %s", kind)
+}
+
+func (a Aliases) clone() Aliases {
+	next := Aliases{Makes: make(map[string]string, len(a.Makes)), Models: make(map[string]string, len(a.Models))}
+	for alias, canonical := range a.Makes {
+		next.Makes[alias] = canonical
+	}
+	for alias, canonical := range a.Models {
+		next.Models[alias] = canonical
+	}
+	return next
+}
+
+// AliasCatalog defines the terms users may type instead of the canonical
+// makes and models of the cars, such as "Chevy" for "Chevrolet". Aliases
+// are looked up once folded. A catalog loaded from a file saves every edit
+// to it.
+type AliasCatalog struct {
+	mu      sync.RWMutex
+	path    string
+	aliases Aliases
+	// folded maps each kind and folded alias to its canonical value
+	folded map[string]map[string]string
+}
+
+// NewAliasCatalog returns a catalog of aliases kept in memory
+func NewAliasCatalog(aliases Aliases) (*AliasCatalog, error) {
+	c := &AliasCatalog{}
+	if err := c.swap(aliases.clone()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadAliases returns the catalog of aliases of a JSON file, such as
+// {"makes": {"VW": "Volkswagen"}, "models": {"F150": "F-150"}}. A missing
+// file gives an empty catalog, the file is created by its first edit.
+func LoadAliases(path string) (*AliasCatalog, error) {
+	var aliases Aliases
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &aliases); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	c := &AliasCatalog{path: path}
+	if err := c.swap(aliases.clone()); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Canonical returns the make or model of the given kind term is an alias
+// of, term itself when it is none
+func (c *AliasCatalog) Canonical(kind, term string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if canonical, ok := c.folded[kind][Fold(term)]; ok {
+		return canonical
+	}
+	return term
+}
+
+// Aliases returns a copy of every alias of the catalog
+func (c *AliasCatalog) Aliases() Aliases {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.aliases.clone()
+}
+
+// Set makes alias stand for canonical, replacing the alias folding the
+// same way if any
+func (c *AliasCatalog) Set(kind, alias, canonical string) error {
+	alias, canonical = strings.TrimSpace(alias), strings.TrimSpace(canonical)
+	if Fold(alias) == "" {
+		return &FieldError{Field: "alias", Err: errors.New("must not be empty")}
+	}
+	if canonical == "" {
+		return &FieldError{Field: "canonical", Err: errors.New("must not be empty")}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := c.aliases.clone()
+	aliases, err := next.kind(kind)
+	if err != nil {
+		return err
+	}
+	for existing := range aliases {
+		if Fold(existing) == Fold(alias) {
+			delete(aliases, existing)
+		}
+	}
+	aliases[alias] = canonical
+	return c.commit(next)
+}
+
+// Delete removes the alias folding the same way as alias
+func (c *AliasCatalog) Delete(kind, alias string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := c.aliases.clone()
+	aliases, err := next.kind(kind)
+	if err != nil {
+		return err
+	}
+	found := false
+	for existing := range aliases {
+		if Fold(existing) == Fold(alias) {
+			delete(aliases, existing)
+			found = true
+		}
+	}
+	if !found {
+		return ErrAliasNotFound
+	}
+	return c.commit(next)
+}
+
+// commit saves the next aliases to the file of the catalog, if any, and
+// swaps them in. It must be called with mu held for writing.
+func (c *AliasCatalog) commit(next Aliases) error {
+	if c.path != "" {
+		if err := saveAliases(c.path, next); err != nil {
+			return err
+		}
+	}
+	return c.swap(next)
+}
+
+// swap replaces the aliases of the catalog, rejecting aliases folding the
+// same way
+func (c *AliasCatalog) swap(aliases Aliases) error {
+	folded := make(map[string]map[string]string)
+	for _, kind := range []string{AliasMakes, AliasModels} {
+		folded[kind] = make(map[string]string)
+		byKind, _ := aliases.kind(kind)
+		seen := make(map[string]string)
+		for alias, canonical := range byKind {
+			key := Fold(alias)
+			if key == "" || strings.TrimSpace(canonical) == "" {
+				return fmt.Errorf("%s alias %q: alias and canonical value must not be empty", kind, alias)
+			}
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("%s aliases %q and %q fold to the same term", kind, other, alias)
+			}
+			seen[key] = alias
+			folded[kind][key] = canonical
+		}
+	}
+	c.aliases, c.folded = aliases, folded
+	return nil
+}
+
+// saveAliases atomically replaces the aliases file
+func saveAliases(path string, aliases Aliases) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(aliases); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
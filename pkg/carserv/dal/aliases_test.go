@@ -0,0 +1,84 @@
+package dal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliasCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	if err := os.WriteFile(path, []byte(`{"makes": {"Chevy": "Chevrolet", "VW": "Volkswagen"}, "models": {"F150": "F-150"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		kind, term, expected string
+	}{
+		{kind: AliasMakes, term: "chevy", expected: "Chevrolet"},
+		{kind: AliasMakes, term: " vw ", expected: "Volkswagen"},
+		{kind: AliasMakes, term: "Chev", expected: "Chev"},
+		{kind: AliasModels, term: "f150", expected: "F-150"},
+		{kind: AliasModels, term: "Chevy", expected: "Chevy"},
+	} {
+		if got := c.Canonical(tc.kind, tc.term); got != tc.expected {
+			t.Errorf("Canonical(%s, %q) Expected: %q, Got: %q", tc.kind, tc.term, tc.expected, got)
+		}
+	}
+
+	if err := c.Set(AliasMakes, "MERC", "Mercedes-Benz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(AliasMakes, "chevy", "Chevrolet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(AliasMakes, "vw"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(AliasMakes, "vw"); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("Expected: %v, Got: %v", ErrAliasNotFound, err)
+	}
+	var fieldErr *FieldError
+	if err := c.Set(AliasModels, "F150", " "); !errors.As(err, &fieldErr) {
+		t.Errorf("Expected a field error, Got: %v", err)
+	}
+
+	// Edits survive a reload of the file
+	reloaded, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Aliases{
+		Makes:  map[string]string{"chevy": "Chevrolet", "MERC": "Mercedes-Benz"},
+		Models: map[string]string{"F150": "F-150"},
+	}
+	if got := reloaded.Aliases(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := LoadAliases(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Canonical(AliasMakes, "Chevy"); got != "Chevy" {
+		t.Errorf("Expected no alias, Got: %q", got)
+	}
+
+	path := filepath.Join(dir, "clash.json")
+	if err := os.WriteFile(path, []byte(`{"makes": {"VW": "Volkswagen", "vw": "Volkswagen"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAliases(path); err == nil {
+		t.Error("Expected aliases folding to the same term to be rejected")
+	}
+}
@@ -1,20 +1,122 @@
 package dal
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Car defines a car struct
 type Car struct {
+	ID           int     `json:"id,omitempty"`
 	Make         string  `json:"make,omitempty"`
 	Model        string  `json:"model,omitempty"`
 	Price        float32 `josn:"budget,omitmepty"`
 	Year         int     `json:"year,omitempty"`
 	VehicleCount int     `json:"-"`
+	Version      int     `json:"-"`
+}
+
+// FieldError defines a validation error for a single field
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Validate returns a *FieldError for the first invalid field of the car
+func (c Car) Validate() error {
+	if c.Make == "" {
+		return &FieldError{Field: fieldMake, Err: errors.New("must not be empty")}
+	}
+	if c.Model == "" {
+		return &FieldError{Field: fieldModel, Err: errors.New("must not be empty")}
+	}
+	if c.Year <= 0 {
+		return &FieldError{Field: fieldYear, Err: fmt.Errorf("must be a positive number: %d", c.Year)}
+	}
+	if c.VehicleCount < 0 {
+		return &FieldError{Field: fieldVehicleCount, Err: fmt.Errorf("must not be negative: %d", c.VehicleCount)}
+	}
+	if c.Price < 0 {
+		return &FieldError{Field: fieldPrice, Err: fmt.Errorf("must not be negative: %v", c.Price)}
+	}
+	return nil
 }
 
 // CarResponse defines an HTTP response struct
 type CarResponse struct {
-	TotalVehicles          int     `json:"total_vehicles,omitempty"`
-	MakeModelTotalVehicles int     `json:"make_model_total_vehicles,omitempty"`
-	Lowest                 float32 `json:"lowest,omitempty"`
-	Median                 float32 `json:"median,omitempty"`
-	Highest                float32 `json:"highest,omitempty"`
-	Suggestions            []Car   `json:"suggestions,omitempty"`
+	TotalVehicles          int                 `json:"total_vehicles,omitempty"`
+	MakeModelTotalVehicles int                 `json:"make_model_total_vehicles,omitempty"`
+	Lowest                 float32             `json:"lowest,omitempty"`
+	Median                 float32             `json:"median,omitempty"`
+	Highest                float32             `json:"highest,omitempty"`
+	Suggestions            []Car               `json:"suggestions,omitempty"`
+	Match                  string              `json:"match,omitempty"`
+	Rank                   string              `json:"rank,omitempty"`
+	BudgetWindow           *BudgetWindow       `json:"budget_window,omitempty"`
+	PriceStats             *PriceStats         `json:"price_stats,omitempty"`
+	Resolved               map[string][]string `json:"resolved,omitempty"`
+	DidYouMean             *DidYouMean         `json:"did_you_mean,omitempty"`
+}
+
+// BudgetWindow defines the prices matching a budget, between Min and Max
+// excluded, given the Under and Over fractions of the budget. The budget
+// itself always matches.
+type BudgetWindow struct {
+	Under float64 `json:"under"`
+	Over  float64 `json:"over"`
+	Min   float32 `json:"min"`
+	Max   float32 `json:"max"`
+}
+
+// PriceStats defines the price stats of the cars matching a search, each car
+// weighing as many vehicles as it holds. Count is the number of vehicles and
+// Cars the number of cars.
+type PriceStats struct {
+	Count  int     `json:"count"`
+	Cars   int     `json:"cars"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P10    float32 `json:"p10"`
+	P25    float32 `json:"p25"`
+	Median float32 `json:"median"`
+	P75    float32 `json:"p75"`
+	P90    float32 `json:"p90"`
+}
+
+// DidYouMean defines the alternatives to a search matching no car: the
+// makes and models its make and model may be misspellings of, the cars
+// matching it without each of its filters and the nearest budget with cars.
+type DidYouMean struct {
+	Make    []string       `json:"make,omitempty"`
+	Model   []string       `json:"model,omitempty"`
+	Relaxed []Relaxation   `json:"relaxed,omitempty"`
+	Budget  *NearestBudget `json:"budget,omitempty"`
+}
+
+// Relaxation defines the vehicles matching a search without one of its
+// filters, named by Without. Makes, Models or Years lists the values of
+// the dropped filter they hold.
+type Relaxation struct {
+	Without  string   `json:"without"`
+	Vehicles int      `json:"vehicles"`
+	Makes    []string `json:"makes,omitempty"`
+	Models   []string `json:"models,omitempty"`
+	Years    []int    `json:"years,omitempty"`
+}
+
+// NearestBudget defines the budget closest to the budget of a search that
+// matches cars along with its other filters, its window and the vehicles
+// within it
+type NearestBudget struct {
+	Budget   float32      `json:"budget"`
+	Window   BudgetWindow `json:"window"`
+	Vehicles int          `json:"vehicles"`
 }
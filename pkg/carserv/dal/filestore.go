@@ -0,0 +1,629 @@
+package dal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy defines when the write-ahead log is flushed to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes the log before every write is acknowledged
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes the log periodically, a crash may lose the
+	// writes of the last interval
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing the log to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	snapshotFile  = "snapshot.json"
+	segmentPrefix = "wal-"
+	segmentSuffix = ".log"
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// ErrStoreClosed is returned when writing to a closed FileStore
+var ErrStoreClosed = errors.New("store is closed")
+
+// ErrStoreFailed is returned when writing to a FileStore whose log could not
+// be rolled back after a failed write
+var ErrStoreFailed = errors.New("store failed")
+
+// ParseSyncPolicy validates a user supplied sync policy
+func ParseSyncPolicy(policy string) (SyncPolicy, error) {
+	switch p := SyncPolicy(strings.ToLower(policy)); p {
+	case SyncAlways, SyncInterval, SyncNever:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown fsync policy: %s", policy)
+}
+
+// FileStoreOptions defines how a FileStore persists writes
+type FileStoreOptions struct {
+	// Sync is the fsync policy of the write-ahead log
+	Sync SyncPolicy
+	// SyncInterval is how often the log is flushed with SyncInterval
+	SyncInterval time.Duration
+	// CompactAfter is the number of logged writes after which a new
+	// snapshot is written and the log truncated, 0 disables compaction
+	// until Close
+	CompactAfter int
+}
+
+// FileStore defines a CarStore persisted in a directory. Writes are
+// appended to a write-ahead log before they are applied in memory, and the
+// log is periodically compacted into a snapshot of the whole dataset.
+//
+// The log is split in segments named after the first version they hold.
+// Opening the store loads the snapshot and replays the writes of every
+// segment that are newer than it.
+type FileStore struct {
+	*MemoryStore
+
+	dir  string
+	opts FileStoreOptions
+	log  *log.Logger
+
+	walMu   sync.Mutex
+	wal     walFile
+	walSize int64
+	entries int
+	dirty   bool
+	closed  bool
+	// failed holds the error leaving the log in an unknown state
+	failed error
+
+	compactMu sync.Mutex
+	compactCh chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// walFile defines the active log segment
+type walFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// storedCar defines the representation of a car on disk
+type storedCar struct {
+	ID           int     `json:"id"`
+	Version      int     `json:"version"`
+	Make         string  `json:"make"`
+	Model        string  `json:"model"`
+	Year         int     `json:"year"`
+	VehicleCount int     `json:"vehicle_count"`
+	Price        float32 `json:"price"`
+}
+
+// walEntry defines a single write in the log
+type walEntry struct {
+	Seq int       `json:"seq"`
+	Op  string    `json:"op"`
+	Car storedCar `json:"car"`
+}
+
+// snapshot defines the compacted dataset on disk
+type snapshot struct {
+	Version int         `json:"version"`
+	NextID  int         `json:"next_id"`
+	Cars    []storedCar `json:"cars"`
+}
+
+// OpenFileStore opens the store persisted in dir, recovering the writes
+// logged since the last snapshot. A new store is seeded with seed.
+func OpenFileStore(dir string, seed []Car, opts FileStoreOptions, logger *log.Logger) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		MemoryStore: &MemoryStore{
+			byID:   make(map[int]int),
+			byKey:  make(map[carKey]int),
+			index:  NewIndex(nil),
+			nextID: 1,
+		},
+		dir:       dir,
+		opts:      opts,
+		log:       logger,
+		compactCh: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	found, err := s.recover()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if err := s.MemoryStore.replace(seed); err != nil {
+			return nil, err
+		}
+		s.log.Printf("Seeded new store in %s with %d cars", dir, len(seed))
+	}
+
+	// Start from a fresh snapshot so that replayed segments can be removed
+	if err := s.Compact(); err != nil {
+		return nil, err
+	}
+	s.MemoryStore.journal = s
+
+	s.wg.Add(1)
+	go s.background()
+	return s, nil
+}
+
+// recover loads the snapshot and replays the log, it returns whether any
+// persisted data was found
+func (s *FileStore) recover() (bool, error) {
+	found := false
+
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err == nil {
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return false, fmt.Errorf("%s: %w", snapshotFile, err)
+		}
+		cars := make([]Car, len(snap.Cars))
+		for i, c := range snap.Cars {
+			cars[i] = c.car()
+		}
+		if err := s.MemoryStore.replace(cars); err != nil {
+			return false, err
+		}
+		// replace assigned new versions, restore the persisted ones
+		for i := range s.MemoryStore.cars {
+			s.MemoryStore.cars[i].Version = snap.Cars[i].Version
+		}
+		s.MemoryStore.version = snap.Version
+		if snap.NextID > s.MemoryStore.nextID {
+			s.MemoryStore.nextID = snap.NextID
+		}
+		found = true
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return false, err
+	}
+	replayed := 0
+	for i, segment := range segments {
+		mutations, err := s.readSegment(segment.path, i == len(segments)-1)
+		if err != nil {
+			return false, err
+		}
+		var pending []mutation
+		for _, m := range mutations {
+			if m.Seq > s.MemoryStore.version {
+				pending = append(pending, m)
+			}
+		}
+		s.MemoryStore.apply(pending)
+		replayed += len(pending)
+		found = found || len(mutations) > 0
+	}
+
+	if found {
+		s.log.Printf("Recovered %d cars from %s, replayed %d logged writes", len(s.MemoryStore.cars), s.dir, replayed)
+	}
+	return found, nil
+}
+
+// readSegment parses a log segment. A torn write at the end of the last
+// segment, left by a crash, is truncated, corruption anywhere else fails.
+func (s *FileStore) readSegment(path string, last bool) ([]mutation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mutations []mutation
+	offset := 0
+	for line := 1; offset < len(data); line++ {
+		end := bytes.IndexByte(data[offset:], '\n')
+		var entry walEntry
+		var parseErr error
+		if end < 0 {
+			parseErr = errors.New("incomplete entry")
+		} else {
+			parseErr = decodeWALLine(data[offset:offset+end], &entry)
+		}
+
+		if parseErr != nil {
+			if last && (end < 0 || offset+end+1 == len(data)) {
+				s.log.Printf("Truncating torn write at %s:%d: %v", path, line, parseErr)
+				if err := os.Truncate(path, int64(offset)); err != nil {
+					return nil, err
+				}
+				break
+			}
+			return nil, fmt.Errorf("%s:%d: corrupted log entry: %w", path, line, parseErr)
+		}
+
+		mutations = append(mutations, entry.mutation())
+		offset += end + 1
+	}
+	return mutations, nil
+}
+
+type segmentFile struct {
+	start int
+	path  string
+}
+
+// segments returns the log segments of the store ordered by their first version
+func (s *FileStore) segments() ([]segmentFile, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []segmentFile
+	for _, path := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+		start, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segmentFile{start: start, path: path})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start < segments[j].start
+	})
+	return segments, nil
+}
+
+// record appends mutations to the log, it is called by the MemoryStore with
+// its write lock held
+func (s *FileStore) record(mutations []mutation) error {
+	var buf bytes.Buffer
+	for _, m := range mutations {
+		if err := encodeWALLine(&buf, newWALEntry(m)); err != nil {
+			return err
+		}
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if s.failed != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, s.failed)
+	}
+	_, err := s.wal.Write(buf.Bytes())
+	if err == nil && s.opts.Sync == SyncAlways {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// The write is not applied, none of its entries may stay in the log
+		// where a later write would reuse their versions
+		if truncErr := s.wal.Truncate(s.walSize); truncErr != nil {
+			s.failed = truncErr
+			s.log.Printf("Failed to roll back the write-ahead log, refusing writes: %v", truncErr)
+		}
+		return err
+	}
+	s.walSize += int64(buf.Len())
+	if s.opts.Sync != SyncAlways {
+		s.dirty = true
+	}
+
+	s.entries += len(mutations)
+	if s.opts.CompactAfter > 0 && s.entries >= s.opts.CompactAfter {
+		select {
+		case s.compactCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Replace swaps the cars served by the store and writes them to a new
+// snapshot. Writes are blocked until the snapshot is written, so that none
+// is logged on top of the previous one, and the previous cars are restored
+// when it cannot be written.
+func (s *FileStore) Replace(cars []Car) error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	m := s.MemoryStore
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prevCars, prevByID, prevByKey, prevIndex, prevNextID := m.cars, m.byID, m.byKey, m.index, m.nextID
+	if err := m.replace(cars); err != nil {
+		return err
+	}
+	snap, current, err := s.checkpoint()
+	if err == nil {
+		snap.Cars = storedCars(current)
+		err = s.writeSnapshot(snap)
+	}
+	if err != nil {
+		// The version stays bumped, versions are never reused
+		m.cars, m.byID, m.byKey, m.index, m.nextID = prevCars, prevByID, prevByKey, prevIndex, prevNextID
+		return err
+	}
+	return s.removeSegments(snap.Version)
+}
+
+// Compact writes a snapshot of the store and removes the log segments it
+// covers. Writes are only blocked while the log is switched to a new segment.
+func (s *FileStore) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.MemoryStore.mu.Lock()
+	snap, cars, err := s.checkpoint()
+	s.MemoryStore.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	snap.Cars = storedCars(cars)
+	if err := s.writeSnapshot(snap); err != nil {
+		return err
+	}
+	return s.removeSegments(snap.Version)
+}
+
+// checkpoint returns the snapshot header and cars of the store and switches
+// the log to a new segment for the writes that follow them. It must be
+// called with the MemoryStore lock held for writing.
+func (s *FileStore) checkpoint() (snapshot, []Car, error) {
+	m := s.MemoryStore
+	snap := snapshot{Version: m.version, NextID: m.nextID}
+	if err := s.rotate(snap.Version + 1); err != nil {
+		return snapshot{}, nil, err
+	}
+	return snap, m.cars, nil
+}
+
+// removeSegments removes the log segments covered by the snapshot of version
+func (s *FileStore) removeSegments(version int) error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment.start <= version {
+			if err := os.Remove(segment.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rotate closes the active log segment and opens a new one starting at start
+func (s *FileStore) rotate(start int) error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if s.wal != nil {
+		if err := s.wal.Sync(); err != nil {
+			return err
+		}
+		if err := s.wal.Close(); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, start, segmentSuffix))
+	wal, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return err
+	}
+	s.wal = wal
+	s.walSize = info.Size()
+	s.entries = 0
+	s.dirty = false
+	return nil
+}
+
+// writeSnapshot atomically replaces the snapshot file
+func (s *FileStore) writeSnapshot(snap snapshot) error {
+	tmp, err := os.CreateTemp(s.dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// background flushes the log with SyncInterval and compacts it when requested
+func (s *FileStore) background() {
+	defer s.wg.Done()
+
+	var tick <-chan time.Time
+	if s.opts.Sync == SyncInterval && s.opts.SyncInterval > 0 {
+		ticker := time.NewTicker(s.opts.SyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-tick:
+			if err := s.sync(); err != nil {
+				s.log.Printf("Failed to sync the write-ahead log: %v", err)
+			}
+		case <-s.compactCh:
+			if err := s.Compact(); err != nil {
+				s.log.Printf("Failed to compact the write-ahead log: %v", err)
+			}
+		}
+	}
+}
+
+func (s *FileStore) sync() error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	if s.closed || !s.dirty {
+		return nil
+	}
+	s.dirty = false
+	return s.wal.Sync()
+}
+
+// Close compacts the log and closes the store, later writes and calls to
+// Close fail with ErrStoreClosed
+func (s *FileStore) Close() error {
+	err := ErrStoreClosed
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		err = s.Compact()
+
+		s.walMu.Lock()
+		defer s.walMu.Unlock()
+		s.closed = true
+		if closeErr := s.wal.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func storedCars(cars []Car) []storedCar {
+	stored := make([]storedCar, len(cars))
+	for i, car := range cars {
+		stored[i] = newStoredCar(car)
+	}
+	return stored
+}
+
+func newStoredCar(car Car) storedCar {
+	return storedCar{
+		ID:           car.ID,
+		Version:      car.Version,
+		Make:         car.Make,
+		Model:        car.Model,
+		Year:         car.Year,
+		VehicleCount: car.VehicleCount,
+		Price:        car.Price,
+	}
+}
+
+func (c storedCar) car() Car {
+	return Car{
+		ID:           c.ID,
+		Version:      c.Version,
+		Make:         c.Make,
+		Model:        c.Model,
+		Year:         c.Year,
+		VehicleCount: c.VehicleCount,
+		Price:        c.Price,
+	}
+}
+
+func newWALEntry(m mutation) walEntry {
+	entry := walEntry{Seq: m.Seq, Op: opPut, Car: newStoredCar(m.Car)}
+	if m.Delete {
+		entry.Op = opDelete
+	}
+	return entry
+}
+
+func (e walEntry) mutation() mutation {
+	return mutation{Seq: e.Seq, Car: e.Car.car(), Delete: e.Op == opDelete}
+}
+
+// encodeWALLine writes an entry as a line of "<crc32 of json> <json>"
+func encodeWALLine(w io.Writer, entry walEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+	return err
+}
+
+func decodeWALLine(line []byte, entry *walEntry) error {
+	sep := bytes.IndexByte(line, ' ')
+	if sep < 0 {
+		return errors.New("missing checksum")
+	}
+	sum, err := strconv.ParseUint(string(line[:sep]), 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid checksum: %w", err)
+	}
+	data := line[sep+1:]
+	if crc32.ChecksumIEEE(data) != uint32(sum) {
+		return errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return err
+	}
+	if entry.Op != opPut && entry.Op != opDelete {
+		return fmt.Errorf("unknown operation: %s", entry.Op)
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,230 @@
+package dal
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	opts := FileStoreOptions{Sync: SyncAlways}
+	seed := []Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+		{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+	}
+
+	store, err := OpenFileStore(dir, seed, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Update(1, func(car Car) (Car, error) {
+		car.Price = 29000
+		return car, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	store.Upsert([]Car{{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 5, Price: 17500}})
+	expected := store.Snapshot().Cars
+
+	// Simulate a crash in the middle of writing an entry
+	segments, err := store.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(segments[len(segments)-1].path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`1234abcd {"seq":9,"op":"put","car":{"id":`))
+	f.Close()
+
+	recovered, err := OpenFileStore(dir, nil, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+
+	if !reflect.DeepEqual(recovered.Snapshot().Cars, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, recovered.Snapshot().Cars)
+	}
+
+	car, err := recovered.Create(Car{Make: "Audi", Model: "A7", Year: 2021, VehicleCount: 1, Price: 36027})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if car.ID != 4 || car.Version <= expected[len(expected)-1].Version {
+		t.Errorf("Expected a new ID and version after recovery, Got: %v", car)
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	store, err := OpenFileStore(dir, nil, FileStoreOptions{Sync: SyncNever}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Create(Car{Make: "Ford", Model: "F-150", Year: 2019 + i, VehicleCount: i, Price: 30000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := store.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("Expected compaction to leave the active segment only, Got: %v", segments)
+	}
+	if info, err := os.Stat(segments[0].path); err != nil || info.Size() != 0 {
+		t.Errorf("Expected an empty active segment, Got: %v %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Error(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != ErrStoreClosed {
+		t.Errorf("Expected: %v, Got: %v", ErrStoreClosed, err)
+	}
+	if _, err := store.Create(Car{Make: "Ford", Model: "Van", Year: 2020, VehicleCount: 1, Price: 40000}); err != ErrStoreClosed {
+		t.Errorf("Expected: %v, Got: %v", ErrStoreClosed, err)
+	}
+
+	reopened, err := OpenFileStore(dir, nil, FileStoreOptions{Sync: SyncNever}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Count() != 3 {
+		t.Errorf("Expected 3 cars, Got: %d", reopened.Count())
+	}
+}
+
+func TestFileStoreReplace(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	opts := FileStoreOptions{Sync: SyncAlways}
+	store, err := OpenFileStore(dir, []Car{{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000}}, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Replace([]Car{{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000}); err != nil {
+		t.Fatal(err)
+	}
+	expected := store.Snapshot().Cars
+
+	// Writes logged after a replace are replayed over its snapshot, even
+	// without a compaction on close
+	recovered, err := OpenFileStore(dir, nil, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+
+	if !reflect.DeepEqual(recovered.Snapshot().Cars, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, recovered.Snapshot().Cars)
+	}
+}
+
+// failingWAL writes part of the first write given to it and then fails,
+// failing truncation too with truncErr
+type failingWAL struct {
+	walFile
+	failed   bool
+	truncErr error
+}
+
+func (f *failingWAL) Truncate(size int64) error {
+	if f.truncErr != nil {
+		return f.truncErr
+	}
+	return f.walFile.Truncate(size)
+}
+
+func (f *failingWAL) Write(p []byte) (int, error) {
+	if f.failed {
+		return f.walFile.Write(p)
+	}
+	f.failed = true
+	n, _ := f.walFile.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+func TestFileStoreFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	logger := log.New(io.Discard, "", 0)
+	opts := FileStoreOptions{Sync: SyncAlways}
+	store, err := OpenFileStore(dir, []Car{{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000}}, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.walMu.Lock()
+	store.wal = &failingWAL{walFile: store.wal}
+	store.walMu.Unlock()
+
+	if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000}); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	if _, err := store.Create(Car{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000}); err != nil {
+		t.Fatal(err)
+	}
+	expected := store.Snapshot().Cars
+
+	// The failed write is neither replayed nor does it shadow the next one
+	recovered, err := OpenFileStore(dir, nil, opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+
+	if !reflect.DeepEqual(recovered.Snapshot().Cars, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, recovered.Snapshot().Cars)
+	}
+}
+
+func TestFileStoreFailedRollback(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	store, err := OpenFileStore(t.TempDir(), nil, FileStoreOptions{Sync: SyncAlways}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	store.walMu.Lock()
+	store.wal = &failingWAL{walFile: store.wal, truncErr: errors.New("read-only file system")}
+	store.walMu.Unlock()
+
+	if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000}); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	if _, err := store.Create(Car{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000}); !errors.Is(err, ErrStoreFailed) {
+		t.Errorf("Expected: %v, Got: %v", ErrStoreFailed, err)
+	}
+}
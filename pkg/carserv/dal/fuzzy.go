@@ -0,0 +1,181 @@
+package dal
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// minTrigramSimilarity is the similarity from which a term resolves to the
+// values sharing the most trigrams with it
+const minTrigramSimilarity = 0.5
+
+// foldReplacer spells out the letters diacritics folding does not decompose
+var foldReplacer = strings.NewReplacer("ß", "ss", "æ", "ae", "ø", "o", "œ", "oe", "ł", "l", "đ", "d")
+
+// Fold returns s lower cased, without diacritics and with its words
+// separated by single spaces, so that "  Škoda  OCTAVIA" folds to
+// "skoda octavia"
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(foldReplacer.Replace(b.String())), " ")
+}
+
+// Resolve returns the values a user supplied term designates, sorted. Once
+// folded, the values containing the term are returned, otherwise the values
+// or words of values the fewest edits away from it, as long as they are
+// within maxEdits of it, otherwise the values sharing the most trigrams
+// with it from minTrigramSimilarity.
+func Resolve(term string, values []string) []string {
+	folded := Fold(term)
+	if folded == "" {
+		return nil
+	}
+
+	var contains []string
+	for _, value := range values {
+		if strings.Contains(Fold(value), folded) {
+			contains = append(contains, value)
+		}
+	}
+	if len(contains) > 0 {
+		sort.Strings(contains)
+		return contains
+	}
+
+	closest := func(distance func(value string) float64) []string {
+		var best []string
+		bestDistance := 0.0
+		for _, value := range values {
+			d := distance(value)
+			switch {
+			case d < 0:
+			case best == nil || d < bestDistance:
+				best, bestDistance = []string{value}, d
+			case d == bestDistance:
+				best = append(best, value)
+			}
+		}
+		sort.Strings(best)
+		return best
+	}
+
+	runes := []rune(folded)
+	bound := maxEdits(len(runes))
+	if edited := closest(func(value string) float64 {
+		foldedValue := Fold(value)
+		d := editDistance(runes, []rune(foldedValue), bound)
+		for _, word := range strings.Fields(foldedValue) {
+			if wd := editDistance(runes, []rune(word), bound); wd < d {
+				d = wd
+			}
+		}
+		if d > bound {
+			return -1
+		}
+		return float64(d)
+	}); edited != nil {
+		return edited
+	}
+
+	return closest(func(value string) float64 {
+		similarity := trigramSimilarity(folded, Fold(value))
+		if similarity < minTrigramSimilarity {
+			return -1
+		}
+		return 1 - similarity
+	})
+}
+
+// maxEdits returns the number of edits tolerated in a term of n runes
+func maxEdits(n int) int {
+	switch {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the optimal string alignment distance of a and b,
+// the number of insertions, deletions, substitutions and transpositions of
+// adjacent runes turning a into b, or max+1 once it exceeds max
+func editDistance(a, b []rune, max int) int {
+	if d := len(a) - len(b); d > max || -d > max {
+		return max + 1
+	}
+
+	// Rows of the distances from the prefixes of a to the prefixes of b
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		row[0] = i
+		rowMin := row[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			row[j] = minInt(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				row[j] = minInt(row[j], prev2[j-2]+1)
+			}
+			rowMin = minInt(rowMin, row[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+	if prev[len(b)] > max {
+		return max + 1
+	}
+	return prev[len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
+
+// trigramSimilarity returns the Dice coefficient of the trigrams of a and
+// b, padded so that short words have trigrams, from 0 for no trigram in
+// common to 1 for the same trigrams
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	var shared int
+	for gram := range ta {
+		if tb[gram] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ta)+len(tb))
+}
+
+func trigrams(s string) map[string]bool {
+	runes := []rune("  " + s + " ")
+	grams := make(map[string]bool)
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = true
+	}
+	return grams
+}
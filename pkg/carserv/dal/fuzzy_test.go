@@ -0,0 +1,47 @@
+package dal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	for value, expected := range map[string]string{
+		"  Škoda  OCTAVIA": "skoda octavia",
+		"Citroën":          "citroen",
+		"Mercedes-Benz":    "mercedes-benz",
+		"Größe":            "grosse",
+	} {
+		if got := Fold(value); got != expected {
+			t.Errorf("Fold(%q) Expected: %q, Got: %q", value, expected, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	values := []string{"Ford", "Honda", "Hyundai", "Citroën", "Transit Van", "Civic", "F-150", "Mercedes-Benz"}
+
+	tests := []struct {
+		term     string
+		expected []string
+	}{
+		{term: "ford", expected: []string{"Ford"}},
+		{term: "citroen", expected: []string{"Citroën"}},
+		{term: "Frod", expected: []string{"Ford"}},
+		{term: "civc", expected: []string{"Civic"}},
+		{term: "tarnsit", expected: []string{"Transit Van"}},
+		{term: "F150", expected: []string{"F-150"}},
+		{term: "mercedez benz", expected: []string{"Mercedes-Benz"}},
+		{term: "h", expected: []string{"Honda", "Hyundai"}},
+		{term: "xyz"},
+		{term: " "},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.term, func(t *testing.T) {
+			if got := Resolve(tc.term, values); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+package dal
+
+import (
+	"sort"
+	"strings"
+)
+
+// Index defines inverted indexes over the cars of a snapshot, mapping each
+// make, model and year to the sorted positions of the cars holding it, and
+// a price index listing every position cheapest first. An index is shared by
+// every reader of its snapshot and never modified, writes derive a new index
+// through an indexWriter.
+type Index struct {
+	makes  postings
+	models postings
+	years  yearPostings
+
+	// byPrice holds every position ordered by price then position, split in
+	// segments that are never empty
+	byPrice []*priceSegment
+
+	// completions of the makes and models, built on first use, and the
+	// completions last built for the indexes derived from the same index
+	completions *Completions
+	lineage     *completionsCache
+	// generation orders the indexes of a lineage
+	generation int
+}
+
+// NewIndex builds the indexes of cars
+func NewIndex(cars []Car) *Index {
+	ix := &Index{lineage: &completionsCache{}}
+	for s := 0; s < postingShards; s++ {
+		ix.makes[s] = make(map[string][]int)
+		ix.models[s] = make(map[string][]int)
+		ix.years[s] = make(map[int][]int)
+	}
+	byPrice := make([]int, len(cars))
+	for i, car := range cars {
+		ix.makes.set(car.Make, append(ix.makes.get(car.Make), i))
+		ix.models.set(car.Model, append(ix.models.get(car.Model), i))
+		ix.years.set(car.Year, append(ix.years.get(car.Year), i))
+		byPrice[i] = i
+	}
+
+	sort.Slice(byPrice, func(a, b int) bool {
+		i, j := byPrice[a], byPrice[b]
+		if cars[i].Price != cars[j].Price {
+			return cars[i].Price < cars[j].Price
+		}
+		return i < j
+	})
+	for start := 0; start < len(byPrice); start += priceSegmentSize {
+		end := start + priceSegmentSize
+		if end > len(byPrice) {
+			end = len(byPrice)
+		}
+		seg := &priceSegment{positions: byPrice[start:end:end], prices: make([]float32, end-start)}
+		for k, i := range seg.positions {
+			seg.prices[k] = cars[i].Price
+		}
+		ix.byPrice = append(ix.byPrice, seg)
+	}
+	return ix
+}
+
+// MakeContains returns the positions of the cars whose make contains substr
+func (ix *Index) MakeContains(substr string) []int {
+	return containing(&ix.makes, substr)
+}
+
+// ModelContains returns the positions of the cars whose model contains substr
+func (ix *Index) ModelContains(substr string) []int {
+	return containing(&ix.models, substr)
+}
+
+// MakeFolded returns the positions of the cars whose make folds to folded,
+// folding each make of the index rather than each car
+func (ix *Index) MakeFolded(folded string) []int {
+	var lists [][]int
+	for _, shard := range ix.makes {
+		for key, list := range shard {
+			if Fold(key) == folded {
+				lists = append(lists, list)
+			}
+		}
+	}
+	return Union(lists...)
+}
+
+// ResolveMake returns the makes a user supplied term designates, see
+// Resolve
+func (ix *Index) ResolveMake(term string) []string {
+	return Resolve(term, ix.makes.keys())
+}
+
+// ResolveModel returns the models a user supplied term designates, see
+// Resolve
+func (ix *Index) ResolveModel(term string) []string {
+	return Resolve(term, ix.models.keys())
+}
+
+// MakeIn returns the positions of the cars of any of the given makes
+func (ix *Index) MakeIn(makes []string) []int {
+	return within(&ix.makes, makes)
+}
+
+// ModelIn returns the positions of the cars of any of the given models
+func (ix *Index) ModelIn(models []string) []int {
+	return within(&ix.models, models)
+}
+
+// Year returns the positions of the cars of the given year
+func (ix *Index) Year(year int) []int {
+	return ix.years.get(year)
+}
+
+// ByPrice returns every position ordered by price, cheapest first
+func (ix *Index) ByPrice() []int {
+	n := 0
+	for _, seg := range ix.byPrice {
+		n += len(seg.positions)
+	}
+	result := make([]int, 0, n)
+	for _, seg := range ix.byPrice {
+		result = append(result, seg.positions...)
+	}
+	return result
+}
+
+// PriceRange returns the positions of the cars priced strictly between low
+// and high ordered by price, cheapest first
+func (ix *Index) PriceRange(low, high float32) []int {
+	s, k := ix.priceSearch(func(price float32, _ int) bool {
+		return price > low
+	})
+	var result []int
+	for ; s < len(ix.byPrice); s, k = s+1, 0 {
+		seg := ix.byPrice[s]
+		end := sort.Search(len(seg.prices), func(j int) bool {
+			return seg.prices[j] >= high
+		})
+		if end > k {
+			result = append(result, seg.positions[k:end]...)
+		}
+		if end < len(seg.prices) {
+			break
+		}
+	}
+	return result
+}
+
+// priceSegmentSize is the number of positions of the price segments of a
+// new index. Writes copy the segments they change rather than the whole
+// price index, a segment splits once it doubles.
+const priceSegmentSize = 512
+
+// priceSegment holds consecutive positions of the price index along with
+// their prices
+type priceSegment struct {
+	positions []int
+	prices    []float32
+}
+
+// priceSearch returns the segment, and the offset in it, of the first entry
+// of the price index for which after is true, len(ix.byPrice) when there is
+// none. after must be false and then true along the index.
+func (ix *Index) priceSearch(after func(price float32, position int) bool) (int, int) {
+	s := sort.Search(len(ix.byPrice), func(s int) bool {
+		seg := ix.byPrice[s]
+		last := len(seg.positions) - 1
+		return after(seg.prices[last], seg.positions[last])
+	})
+	if s == len(ix.byPrice) {
+		return s, 0
+	}
+	seg := ix.byPrice[s]
+	return s, sort.Search(len(seg.positions), func(k int) bool {
+		return after(seg.prices[k], seg.positions[k])
+	})
+}
+
+// postingShards is the number of shards of a postings map. Writes copy the
+// shards of the keys they change rather than every key.
+const postingShards = 32
+
+// postings maps each key to the sorted positions of the cars holding it,
+// split in shards by the hash of the key
+type postings [postingShards]map[string][]int
+
+func (p *postings) get(key string) []int {
+	return p[shardOf(key)][key]
+}
+
+// set replaces the positions of key, dropping the key without any
+func (p *postings) set(key string, list []int) {
+	if len(list) == 0 {
+		delete(p[shardOf(key)], key)
+		return
+	}
+	p[shardOf(key)][key] = list
+}
+
+func (p *postings) keys() []string {
+	var result []string
+	for _, shard := range p {
+		for key := range shard {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// shardOf returns the shard of a key, hashed with FNV-1a
+func shardOf(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % postingShards)
+}
+
+// yearPostings maps each year to the sorted positions of the cars of that
+// year, split in shards by year
+type yearPostings [postingShards]map[int][]int
+
+func (p *yearPostings) get(year int) []int {
+	return p[yearShardOf(year)][year]
+}
+
+// set replaces the positions of year, dropping the year without any
+func (p *yearPostings) set(year int, list []int) {
+	if len(list) == 0 {
+		delete(p[yearShardOf(year)], year)
+		return
+	}
+	p[yearShardOf(year)][year] = list
+}
+
+func yearShardOf(year int) int {
+	return int(uint(year) % postingShards)
+}
+
+// containing unites the posting lists of every key containing substr, the
+// cost depends on the number of distinct keys rather than cars
+func containing(p *postings, substr string) []int {
+	if substr == "" {
+		return nil
+	}
+	var lists [][]int
+	for _, shard := range p {
+		for key, list := range shard {
+			if strings.Contains(key, substr) {
+				lists = append(lists, list)
+			}
+		}
+	}
+	return Union(lists...)
+}
+
+// within unites the posting lists of the given keys
+func within(p *postings, keys []string) []int {
+	lists := make([][]int, 0, len(keys))
+	for _, key := range keys {
+		lists = append(lists, p.get(key))
+	}
+	return Union(lists...)
+}
+
+// Union returns the sorted positions present in any of the sorted lists
+func Union(lists ...[]int) []int {
+	for len(lists) > 1 {
+		var merged [][]int
+		for i := 0; i < len(lists); i += 2 {
+			if i+1 == len(lists) {
+				merged = append(merged, lists[i])
+				continue
+			}
+			merged = append(merged, union(lists[i], lists[i+1]))
+		}
+		lists = merged
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+	return lists[0]
+}
+
+func union(a, b []int) []int {
+	result := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			result = append(result, a[0])
+			a = a[1:]
+		case a[0] > b[0]:
+			result = append(result, b[0])
+			b = b[1:]
+		default:
+			result = append(result, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	result = append(result, a...)
+	return append(result, b...)
+}
+
+// Intersect returns the sorted positions present in both sorted lists
+func Intersect(a, b []int) []int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	var result []int
+	for _, pos := range a {
+		// Skip ahead in the longer list instead of walking it
+		j := sort.SearchInts(b, pos)
+		if j < len(b) && b[j] == pos {
+			result = append(result, pos)
+		}
+		b = b[j:]
+	}
+	return result
+}
+
+// indexWriter derives a new index from a shared one, copying each shard of
+// postings, posting list and the price index at most once, and only when a
+// car changes them
+type indexWriter struct {
+	ix *Index
+	// shards and lists of the postings already copied
+	makeShards, modelShards, yearShards [postingShards]bool
+	makes, models                       map[string]bool
+	years                               map[int]bool
+	// segments tells the list of price segments was copied, owned holds
+	// the segments copied since
+	segments bool
+	owned    map[*priceSegment]bool
+}
+
+func newIndexWriter(shared *Index) *indexWriter {
+	return &indexWriter{
+		// Shards and the price index are shared until the first change
+		ix: &Index{
+			makes:   shared.makes,
+			models:  shared.models,
+			years:   shared.years,
+			byPrice: shared.byPrice,
+
+			lineage:    shared.lineage,
+			generation: shared.generation + 1,
+		},
+		makes:  make(map[string]bool),
+		models: make(map[string]bool),
+		years:  make(map[int]bool),
+		owned:  make(map[*priceSegment]bool),
+	}
+}
+
+// add indexes the car at position i
+func (w *indexWriter) add(i int, car Car) {
+	w.ix.makes.set(car.Make, insertPosition(ownPostings(&w.ix.makes, &w.makeShards, w.makes, car.Make), i))
+	w.ix.models.set(car.Model, insertPosition(ownPostings(&w.ix.models, &w.modelShards, w.models, car.Model), i))
+	w.ix.years.set(car.Year, insertPosition(w.ownYear(car.Year), i))
+
+	s, k := w.priceSearch(i, car.Price)
+	if s == len(w.ix.byPrice) {
+		if s == 0 {
+			w.ownSegments()
+			seg := &priceSegment{}
+			w.owned[seg] = true
+			w.ix.byPrice = append(w.ix.byPrice, seg)
+		} else {
+			// Past every entry, the last segment grows
+			s--
+			k = len(w.ix.byPrice[s].positions)
+		}
+	}
+	seg := w.ownSegment(s)
+	seg.positions = append(seg.positions, 0)
+	copy(seg.positions[k+1:], seg.positions[k:])
+	seg.positions[k] = i
+	seg.prices = append(seg.prices, 0)
+	copy(seg.prices[k+1:], seg.prices[k:])
+	seg.prices[k] = car.Price
+
+	if half := len(seg.positions) / 2; half >= priceSegmentSize {
+		next := &priceSegment{
+			positions: append([]int(nil), seg.positions[half:]...),
+			prices:    append([]float32(nil), seg.prices[half:]...),
+		}
+		seg.positions, seg.prices = seg.positions[:half:half], seg.prices[:half:half]
+		w.owned[next] = true
+		w.ix.byPrice = append(w.ix.byPrice, nil)
+		copy(w.ix.byPrice[s+2:], w.ix.byPrice[s+1:])
+		w.ix.byPrice[s+1] = next
+	}
+}
+
+// remove drops the car at position i from the index
+func (w *indexWriter) remove(i int, car Car) {
+	w.ix.makes.set(car.Make, removePosition(ownPostings(&w.ix.makes, &w.makeShards, w.makes, car.Make), i))
+	w.ix.models.set(car.Model, removePosition(ownPostings(&w.ix.models, &w.modelShards, w.models, car.Model), i))
+	w.ix.years.set(car.Year, removePosition(w.ownYear(car.Year), i))
+
+	s, k := w.priceSearch(i, car.Price)
+	if s == len(w.ix.byPrice) || w.ix.byPrice[s].positions[k] != i {
+		return
+	}
+	seg := w.ownSegment(s)
+	seg.positions = append(seg.positions[:k], seg.positions[k+1:]...)
+	seg.prices = append(seg.prices[:k], seg.prices[k+1:]...)
+	if len(seg.positions) == 0 {
+		w.ix.byPrice = append(w.ix.byPrice[:s], w.ix.byPrice[s+1:]...)
+	}
+}
+
+// priceSearch returns the segment and offset where position i priced at
+// price is, or belongs, in the price index
+func (w *indexWriter) priceSearch(i int, price float32) (int, int) {
+	return w.ix.priceSearch(func(p float32, j int) bool {
+		if p != price {
+			return p > price
+		}
+		return j >= i
+	})
+}
+
+// ownSegments copies the list of price segments the first time the writer
+// changes it
+func (w *indexWriter) ownSegments() {
+	if !w.segments {
+		w.ix.byPrice = append([]*priceSegment(nil), w.ix.byPrice...)
+		w.segments = true
+	}
+}
+
+// ownSegment returns the price segment s, copying it the first time the
+// writer changes it
+func (w *indexWriter) ownSegment(s int) *priceSegment {
+	w.ownSegments()
+	seg := w.ix.byPrice[s]
+	if !w.owned[seg] {
+		seg = &priceSegment{
+			positions: append([]int(nil), seg.positions...),
+			prices:    append([]float32(nil), seg.prices...),
+		}
+		w.ix.byPrice[s] = seg
+		w.owned[seg] = true
+	}
+	return seg
+}
+
+// ownPostings returns the positions of key in p, copying the shard of key
+// and its list the first time the writer changes them
+func ownPostings(p *postings, shards *[postingShards]bool, lists map[string]bool, key string) []int {
+	if s := shardOf(key); !shards[s] {
+		p[s] = copyShard(p[s])
+		shards[s] = true
+	}
+	if !lists[key] {
+		p.set(key, append([]int(nil), p.get(key)...))
+		lists[key] = true
+	}
+	return p.get(key)
+}
+
+// ownYear returns the positions of year, copying its shard and list the
+// first time the writer changes them
+func (w *indexWriter) ownYear(year int) []int {
+	if s := yearShardOf(year); !w.yearShards[s] {
+		shard := make(map[int][]int, len(w.ix.years[s]))
+		for k, v := range w.ix.years[s] {
+			shard[k] = v
+		}
+		w.ix.years[s] = shard
+		w.yearShards[s] = true
+	}
+	if !w.years[year] {
+		w.ix.years.set(year, append([]int(nil), w.ix.years.get(year)...))
+		w.years[year] = true
+	}
+	return w.ix.years.get(year)
+}
+
+func copyShard(shard map[string][]int) map[string][]int {
+	result := make(map[string][]int, len(shard))
+	for k, v := range shard {
+		result[k] = v
+	}
+	return result
+}
+
+func insertPosition(list []int, i int) []int {
+	j := sort.SearchInts(list, i)
+	if j < len(list) && list[j] == i {
+		return list
+	}
+	list = append(list, 0)
+	copy(list[j+1:], list[j:])
+	list[j] = i
+	return list
+}
+
+func removePosition(list []int, i int) []int {
+	j := sort.SearchInts(list, i)
+	if j == len(list) || list[j] != i {
+		return list
+	}
+	return append(list[:j], list[j+1:]...)
+}
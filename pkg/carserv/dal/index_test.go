@@ -0,0 +1,157 @@
+package dal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexMaintainedOnWrites(t *testing.T) {
+	store := NewMemoryStore([]Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+		{Make: "Ford", Model: "Transit Van", Year: 2020, VehicleCount: 4, Price: 42000},
+		{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+	})
+	shared := store.Snapshot()
+
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{
+			name: "Create",
+			write: func() error {
+				_, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000})
+				return err
+			},
+		},
+		{
+			name: "Update",
+			write: func() error {
+				_, err := store.Update(1, func(car Car) (Car, error) {
+					car.Make, car.Year = "Honda", 2021
+					return car, nil
+				})
+				return err
+			},
+		},
+		{
+			name: "Upsert",
+			write: func() error {
+				store.Upsert([]Car{
+					{Make: "Ford", Model: "Van", Year: 2018, VehicleCount: 1, Price: 35000},
+					{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 5, Price: 17500},
+				})
+				return nil
+			},
+		},
+		{
+			name: "Delete",
+			write: func() error {
+				return store.Delete(2, nil)
+			},
+		},
+	}
+
+	for _, tc := range writes {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.write(); err != nil {
+				t.Fatal(err)
+			}
+			snap := store.Snapshot()
+			if expected := NewIndex(snap.Cars); !reflect.DeepEqual(indexEntries(snap.Index), indexEntries(expected)) {
+				t.Errorf("Expected: %v, Got: %v", indexEntries(expected), indexEntries(snap.Index))
+			}
+		})
+	}
+
+	if expected := NewIndex(shared.Cars); !reflect.DeepEqual(indexEntries(shared.Index), indexEntries(expected)) {
+		t.Errorf("Expected writes to leave older snapshots unchanged, Got: %v", indexEntries(shared.Index))
+	}
+}
+
+// indexEntries returns the positions an index holds for each key and price,
+// leaving out how it was derived
+func indexEntries(ix *Index) []interface{} {
+	return []interface{}{ix.makes, ix.models, ix.years, ix.ByPrice()}
+}
+
+func TestPriceSegments(t *testing.T) {
+	// Enough cars for several segments, priced out of position order
+	cars := make([]Car, 3*priceSegmentSize)
+	for i := range cars {
+		cars[i] = Car{Make: "Ford", Model: "F-150", Year: 2000 + i%20, VehicleCount: 1, Price: float32(i * 7919 % 1000)}
+	}
+	store := NewMemoryStore(cars)
+
+	// Creates past the most expensive car split the last segment
+	for i := 0; i < 2*priceSegmentSize; i++ {
+		if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 1, Price: 5000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Deleting them empties the segments they split into, deleting cars
+	// of the first segments moves the last cars into their positions
+	for id := len(cars) + 1; id <= len(cars)+2*priceSegmentSize; id++ {
+		if err := store.Delete(id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := 1; id <= priceSegmentSize; id += 3 {
+		if err := store.Delete(id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Update(len(cars), func(car Car) (Car, error) {
+		car.Price = 0
+		return car, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := store.Snapshot()
+	expected := NewIndex(snap.Cars)
+	if got := snap.Index.ByPrice(); !reflect.DeepEqual(got, expected.ByPrice()) {
+		t.Errorf("Expected: %v, Got: %v", expected.ByPrice(), got)
+	}
+	for _, r := range [][2]float32{{-1, 1e9}, {0, 500}, {499, 5000}, {5000, 6000}, {300, 300}} {
+		if got := snap.Index.PriceRange(r[0], r[1]); !reflect.DeepEqual(got, expected.PriceRange(r[0], r[1])) {
+			t.Errorf("Expected %v: %v, Got: %v", r, expected.PriceRange(r[0], r[1]), got)
+		}
+	}
+	for _, seg := range snap.Index.byPrice {
+		if len(seg.positions) == 0 || len(seg.positions) >= 2*priceSegmentSize {
+			t.Errorf("Expected segments of 1 to %d positions, Got: %d", 2*priceSegmentSize-1, len(seg.positions))
+		}
+	}
+}
+
+func TestIndexLookups(t *testing.T) {
+	ix := NewIndex([]Car{
+		{Make: "Ford", Model: "F-150", Year: 2019},
+		{Make: "Ford", Model: "Transit Van", Year: 2020},
+		{Make: "Honda", Model: "Civic", Year: 2019},
+		{Make: "Ford", Model: "Van", Year: 2019},
+	})
+
+	tests := []struct {
+		name     string
+		got      []int
+		expected []int
+	}{
+		{name: "Make", got: ix.MakeContains("Ford"), expected: []int{0, 1, 3}},
+		{name: "ModelSubstring", got: ix.ModelContains("Van"), expected: []int{1, 3}},
+		{name: "Year", got: ix.Year(2019), expected: []int{0, 2, 3}},
+		{name: "Union", got: Union(ix.ModelContains("Van"), ix.MakeContains("Honda")), expected: []int{1, 2, 3}},
+		{name: "Intersect", got: Intersect(ix.MakeContains("Ford"), ix.Year(2019)), expected: []int{0, 3}},
+		{name: "MakeFolded", got: ix.MakeFolded("ford"), expected: []int{0, 1, 3}},
+		{name: "Missing", got: ix.MakeContains("Volvo"), expected: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.got, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, tc.got)
+			}
+		})
+	}
+}
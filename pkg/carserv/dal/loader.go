@@ -0,0 +1,455 @@
+package dal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format defines a dataset file format
+type Format string
+
+const (
+	// FormatCSV is a comma separated file with a header row
+	FormatCSV Format = "csv"
+	// FormatJSON is a JSON array of car objects
+	FormatJSON Format = "json"
+	// FormatNDJSON is a newline delimited stream of car objects
+	FormatNDJSON Format = "ndjson"
+)
+
+const (
+	fieldID           = "id"
+	fieldMake         = "make"
+	fieldModel        = "model"
+	fieldYear         = "year"
+	fieldVehicleCount = "vehicle_count"
+	fieldPrice        = "price"
+)
+
+// ErrEmptyDataset is returned when a dataset contains no valid rows
+var ErrEmptyDataset = errors.New("dataset contains no valid rows")
+
+// RowError defines an error for a single malformed dataset row
+type RowError struct {
+	Line  int
+	Field string
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: field %s: %v", e.Line, e.Field, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is returned by LoadFile in strict mode when rows are malformed
+type LoadError struct {
+	Path string
+	Rows []*RowError
+}
+
+func (e *LoadError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%d malformed rows, first: %v", len(e.Rows), e.Rows[0])
+	}
+	return fmt.Sprintf("%s: %d malformed rows, first: %v", e.Path, len(e.Rows), e.Rows[0])
+}
+
+// LoadOptions defines how a dataset file is read
+type LoadOptions struct {
+	// Format of the file, detected from the file extension when empty
+	Format Format
+	// Strict rejects the whole file if any row is malformed, otherwise
+	// malformed rows are skipped and reported
+	Strict bool
+}
+
+// FormatFromPath returns the dataset format matching the file extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unknown dataset format for file: %s", path)
+}
+
+// ParseFormat validates a user supplied dataset format
+func ParseFormat(format string) (Format, error) {
+	switch f := Format(strings.ToLower(format)); f {
+	case FormatCSV, FormatJSON, FormatNDJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown dataset format: %s", format)
+}
+
+// LoadFile reads every car from a dataset file. Malformed rows are returned
+// alongside the cars in lenient mode and cause a *LoadError in strict mode.
+func LoadFile(path string, opts LoadOptions) ([]Car, []*RowError, error) {
+	format := opts.Format
+	if format == "" {
+		var err error
+		format, err = FormatFromPath(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	opts.Format = format
+	cars, rowErrs, err := LoadReader(f, opts)
+	if err != nil {
+		var loadErr *LoadError
+		if errors.As(err, &loadErr) {
+			loadErr.Path = path
+			return nil, rowErrs, loadErr
+		}
+		return nil, rowErrs, fmt.Errorf("%s: %w", path, err)
+	}
+	return cars, rowErrs, nil
+}
+
+// LoadReader reads every car from r in the format given by opts, which must
+// be set. Malformed rows are handled as in LoadFile.
+func LoadReader(r io.Reader, opts LoadOptions) ([]Car, []*RowError, error) {
+	dec, err := NewDecoder(r, opts.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cars []Car
+	var rowErrs []*RowError
+	for {
+		car, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rowErrs = append(rowErrs, rowErr)
+			continue
+		}
+		if err != nil {
+			return nil, rowErrs, err
+		}
+		cars = append(cars, car)
+	}
+
+	if opts.Strict && len(rowErrs) > 0 {
+		return nil, rowErrs, &LoadError{Rows: rowErrs}
+	}
+	if len(cars) == 0 {
+		return nil, rowErrs, ErrEmptyDataset
+	}
+	return cars, rowErrs, nil
+}
+
+// Decoder reads cars from a dataset stream one row at a time
+type Decoder struct {
+	next func() (Car, error)
+	line int
+}
+
+// NewDecoder returns a decoder reading rows of the given format from r
+func NewDecoder(r io.Reader, format Format) (*Decoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVDecoder(r), nil
+	case FormatJSON:
+		return newJSONDecoder(r), nil
+	case FormatNDJSON:
+		return newNDJSONDecoder(r), nil
+	}
+	return nil, fmt.Errorf("unknown dataset format: %s", format)
+}
+
+// Decode returns the next car in the stream. A *RowError is returned for a
+// malformed row and decoding may continue, io.EOF is returned at the end of
+// the stream and any other error means the stream cannot be read further.
+func (d *Decoder) Decode() (Car, error) {
+	return d.next()
+}
+
+// Line returns the line the last decoded row started on
+func (d *Decoder) Line() int {
+	return d.line
+}
+
+func newCSVDecoder(r io.Reader) *Decoder {
+	records := newCSVRecords(r)
+
+	var header []string
+	d := &Decoder{}
+	d.next = func() (Car, error) {
+		for {
+			record, line, err := records.next()
+			d.line = line
+			if err == io.EOF {
+				if header == nil {
+					return Car{}, errors.New("missing csv header")
+				}
+				return Car{}, io.EOF
+			}
+			if err != nil {
+				return Car{}, err
+			}
+
+			if header == nil {
+				header = make([]string, len(record))
+				for i, name := range record {
+					header[i] = normalizeField(name)
+				}
+				continue
+			}
+
+			if len(record) != len(header) {
+				return Car{}, &RowError{Line: line, Err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))}
+			}
+
+			fields := make(map[string]string, len(record))
+			for i, value := range record {
+				fields[header[i]] = value
+			}
+			return carFromFields(fields, line)
+		}
+	}
+	return d
+}
+
+// csvRecords splits a CSV stream into records along with the line each
+// starts on, which csv.Reader only reports for errors. The physical lines of
+// a record are gathered until its quotes are balanced, so that quoted fields
+// may span lines, and parsed on their own.
+type csvRecords struct {
+	r    *bufio.Reader
+	line int
+
+	// chunk and buf are reused to parse each record
+	chunk strings.Reader
+	buf   *bufio.Reader
+}
+
+func newCSVRecords(r io.Reader) *csvRecords {
+	return &csvRecords{r: bufio.NewReader(r), buf: bufio.NewReader(nil)}
+}
+
+// next returns the next record and the line it starts on, skipping blank
+// lines. A malformed record is returned as a *RowError.
+func (c *csvRecords) next() ([]string, int, error) {
+	var chunk strings.Builder
+	start, quotes := 0, 0
+	for {
+		text, err := c.r.ReadString('\n')
+		if text != "" {
+			c.line++
+			if chunk.Len() > 0 || strings.TrimSpace(text) != "" {
+				if start == 0 {
+					start = c.line
+				}
+				chunk.WriteString(text)
+				quotes += strings.Count(text, `"`)
+			}
+		}
+		if err == io.EOF {
+			if chunk.Len() == 0 {
+				return nil, c.line + 1, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return nil, c.line, err
+		}
+		if chunk.Len() > 0 && quotes%2 == 0 {
+			break
+		}
+	}
+
+	c.chunk.Reset(chunk.String())
+	c.buf.Reset(&c.chunk)
+	reader := csv.NewReader(c.buf)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	record, err := reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, start, &RowError{Line: start + parseErr.Line - 1, Err: parseErr.Err}
+	}
+	return record, start, err
+}
+
+func newJSONDecoder(r io.Reader) *Decoder {
+	counter := &lineCounter{r: r}
+	dec := json.NewDecoder(counter)
+	started := false
+	d := &Decoder{}
+	d.next = func() (Car, error) {
+		if !started {
+			tok, err := dec.Token()
+			if err != nil {
+				return Car{}, err
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return Car{}, errors.New("expected a JSON array of cars")
+			}
+			started = true
+		}
+
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return Car{}, err
+			}
+			return Car{}, io.EOF
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return Car{}, fmt.Errorf("line %d: %w", counter.lineAt(dec.InputOffset()), err)
+		}
+		d.line = counter.lineAt(dec.InputOffset() - int64(len(raw)))
+		return carFromJSON(raw, d.line)
+	}
+	return d
+}
+
+func newNDJSONDecoder(r io.Reader) *Decoder {
+	reader := bufio.NewReader(r)
+	line := 0
+	d := &Decoder{}
+	d.next = func() (Car, error) {
+		for {
+			text, err := reader.ReadString('\n')
+			if err != nil && (err != io.EOF || text == "") {
+				return Car{}, err
+			}
+			line++
+			d.line = line
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			return carFromJSON([]byte(text), line)
+		}
+	}
+	return d
+}
+
+func carFromJSON(raw []byte, line int) (Car, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return Car{}, &RowError{Line: line, Err: err}
+	}
+
+	fields := make(map[string]string, len(object))
+	for key, value := range object {
+		var text string
+		if err := json.Unmarshal(value, &text); err != nil {
+			text = string(value)
+		}
+		fields[normalizeField(key)] = text
+	}
+	return carFromFields(fields, line)
+}
+
+// carFromFields builds a car out of normalized field names and their values
+func carFromFields(fields map[string]string, line int) (Car, error) {
+	var car Car
+	var err error
+
+	if id := strings.TrimSpace(fields[fieldID]); id != "" {
+		car.ID, err = strconv.Atoi(id)
+		if err != nil {
+			return Car{}, &RowError{Line: line, Field: fieldID, Err: err}
+		}
+		if car.ID < 0 {
+			return Car{}, &RowError{Line: line, Field: fieldID, Err: fmt.Errorf("must not be negative: %d", car.ID)}
+		}
+	}
+
+	car.Make = strings.TrimSpace(fields[fieldMake])
+	car.Model = strings.TrimSpace(fields[fieldModel])
+
+	car.Year, err = strconv.Atoi(strings.TrimSpace(fields[fieldYear]))
+	if err != nil {
+		return Car{}, &RowError{Line: line, Field: fieldYear, Err: err}
+	}
+
+	car.VehicleCount, err = strconv.Atoi(strings.TrimSpace(fields[fieldVehicleCount]))
+	if err != nil {
+		return Car{}, &RowError{Line: line, Field: fieldVehicleCount, Err: err}
+	}
+
+	price, err := strconv.ParseFloat(strings.TrimSpace(fields[fieldPrice]), 32)
+	if err != nil {
+		return Car{}, &RowError{Line: line, Field: fieldPrice, Err: err}
+	}
+	car.Price = float32(price)
+
+	if err := car.Validate(); err != nil {
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) {
+			return Car{}, &RowError{Line: line, Field: fieldErr.Field, Err: fieldErr.Err}
+		}
+		return Car{}, &RowError{Line: line, Err: err}
+	}
+
+	return car, nil
+}
+
+// normalizeField maps header and key spellings such as "VehicleCount",
+// "vehicle count" or "vehicle_count" onto the same field name
+func normalizeField(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+	if name == "vehiclecount" {
+		return fieldVehicleCount
+	}
+	return name
+}
+
+// lineCounter tracks newlines read through it to map byte offsets to lines
+type lineCounter struct {
+	r        io.Reader
+	read     int64
+	newlines []int64
+	line     int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == '\n' {
+			c.newlines = append(c.newlines, c.read+int64(i))
+		}
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+// lineAt returns the line of offset. Offsets must not decrease between calls.
+func (c *lineCounter) lineAt(offset int64) int {
+	for len(c.newlines) > 0 && c.newlines[0] < offset {
+		c.line++
+		c.newlines = c.newlines[1:]
+	}
+	return c.line + 1
+}
@@ -0,0 +1,136 @@
+package dal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		input    string
+		expected []Car
+		rowErrs  []RowError
+	}{
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			input: "Make,Model,Year,VehicleCount,Price\n" +
+				"Ford,F-150,2019,10,30000\n" +
+				"Ford,Van,twenty,4,42000\n" +
+				"Honda,Civic,2019,7,21000.5\n",
+			expected: []Car{
+				{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+				{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000.5},
+			},
+			rowErrs: []RowError{{Line: 3, Field: "year"}},
+		},
+		{
+			name:   "CSVPhysicalLines",
+			format: FormatCSV,
+			input: "make,model,year,vehicle_count,price\n" +
+				"\n" +
+				"Ford,\"F-150\nRaptor\",2019,10,30000\n" +
+				"Ford,Van,twenty,4,42000\n" +
+				"  \n" +
+				"Kia,\"Soul\",2020,3\n" +
+				"Honda,Civic,2019,7,21000\n",
+			expected: []Car{
+				{Make: "Ford", Model: "F-150\nRaptor", Year: 2019, VehicleCount: 10, Price: 30000},
+				{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+			},
+			rowErrs: []RowError{{Line: 5, Field: "year"}, {Line: 7}},
+		},
+		{
+			name:   "JSON",
+			format: FormatJSON,
+			input: `[
+  {"make": "Ford", "model": "F-150", "year": 2019, "vehicle_count": 10, "price": 30000},
+  {"make": "", "model": "Van", "year": 2020, "vehicle_count": 4, "price": 42000},
+  {"make": "Honda", "model": "Civic", "year": "2019", "vehicle_count": 7, "price": -1}
+]`,
+			expected: []Car{
+				{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+			},
+			rowErrs: []RowError{{Line: 3, Field: "make"}, {Line: 4, Field: "price"}},
+		},
+		{
+			name:   "NDJSON",
+			format: FormatNDJSON,
+			input: `{"Make": "Ford", "Model": "F-150", "Year": 2019, "VehicleCount": 10, "Price": 30000}
+
+{"make": "Ford", "model": "Van"
+{"make": "Honda", "model": "Civic", "year": 2019, "vehicle_count": 7, "price": 21000}`,
+			expected: []Car{
+				{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+				{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+			},
+			rowErrs: []RowError{{Line: 3}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dec, err := NewDecoder(strings.NewReader(tc.input), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var cars []Car
+			var rowErrs []RowError
+			for {
+				car, err := dec.Decode()
+				if err == io.EOF {
+					break
+				}
+				var rowErr *RowError
+				if errors.As(err, &rowErr) {
+					rowErrs = append(rowErrs, RowError{Line: rowErr.Line, Field: rowErr.Field})
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				cars = append(cars, car)
+			}
+
+			if !reflect.DeepEqual(cars, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, cars)
+			}
+			if !reflect.DeepEqual(rowErrs, tc.rowErrs) {
+				t.Errorf("Expected row errors: %v, Got: %v", tc.rowErrs, rowErrs)
+			}
+		})
+	}
+}
+
+func TestLoadFileStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cars.csv")
+	input := "make,model,year,vehicle_count,price\nFord,F-150,2019,10,30000\nFord,Van,2020,4\n"
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cars, rowErrs, err := LoadFile(path, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cars) != 1 || len(rowErrs) != 1 {
+		t.Errorf("Expected 1 car and 1 row error, Got: %d cars and %d row errors", len(cars), len(rowErrs))
+	}
+
+	_, _, err = LoadFile(path, LoadOptions{Strict: true})
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("Expected a load error, Got: %v", err)
+	}
+	if loadErr.Rows[0].Line != 3 {
+		t.Errorf("Expected the error on line 3, Got: %v", loadErr.Rows[0])
+	}
+}
@@ -0,0 +1,159 @@
+package dal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReloadStatus describes the outcome of the last dataset reload
+type ReloadStatus struct {
+	Path        string    `json:"path"`
+	Records     int       `json:"records"`
+	SkippedRows int       `json:"skipped_rows"`
+	Hash        string    `json:"hash,omitempty"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Reloader loads a dataset file into a store and swaps in a new dataset
+// whenever the file changes. A file that fails to load leaves the store
+// serving the previous dataset.
+type Reloader struct {
+	path  string
+	opts  LoadOptions
+	store Replacer
+	log   *log.Logger
+
+	mu      sync.Mutex
+	status  ReloadStatus
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader returns a reloader loading path into store
+func NewReloader(path string, opts LoadOptions, store Replacer, logger *log.Logger) *Reloader {
+	return &Reloader{
+		path:   path,
+		opts:   opts,
+		store:  store,
+		log:    logger,
+		status: ReloadStatus{Path: path},
+	}
+}
+
+// Status returns the outcome of the last reload
+func (r *Reloader) Status() ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Reload parses the dataset file and swaps it into the store
+func (r *Reloader) Reload() (ReloadStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.reload()
+	if err != nil {
+		r.status.Error = err.Error()
+		r.log.Printf("Failed to reload dataset %s, keeping the previous dataset: %v", r.path, err)
+	}
+	return r.status, err
+}
+
+// Watch polls the dataset file every interval and reloads it when its
+// modification time or size changes, until done is closed
+func (r *Reloader) Watch(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if r.changed() {
+				r.Reload()
+			}
+		}
+	}
+}
+
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.log.Printf("Failed to stat dataset %s: %v", r.path, err)
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// reload must be called with mu held
+func (r *Reloader) reload() error {
+	r.status.LastAttempt = time.Now()
+
+	format := r.opts.Format
+	if format == "" {
+		var err error
+		format, err = FormatFromPath(r.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// Remember the file version even if it fails to load, so a broken file
+	// is not parsed again on every poll
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+
+	hash := sha256.New()
+	opts := r.opts
+	opts.Format = format
+	cars, rowErrs, err := LoadReader(io.TeeReader(f, hash), opts)
+	for _, rowErr := range rowErrs {
+		r.log.Printf("Malformed dataset row in %s: %v", r.path, rowErr)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if sum == r.status.Hash {
+		r.log.Printf("Dataset %s is unchanged", r.path)
+	} else if err := r.store.Replace(cars); err != nil {
+		return err
+	} else {
+		r.log.Printf("Loaded %d cars from %s, skipped %d malformed rows", len(cars), r.path, len(rowErrs))
+	}
+
+	r.status.Records = len(cars)
+	r.status.SkippedRows = len(rowErrs)
+	r.status.Hash = sum
+	r.status.LastSuccess = r.status.LastAttempt
+	r.status.Error = ""
+	return nil
+}
@@ -0,0 +1,47 @@
+package dal
+
+import "math"
+
+// WeightedPriceStats returns the price stats of the cars at positions, which
+// are ordered by price, each car counting as many times as it has vehicles.
+// Cars without vehicles only count in Cars.
+func WeightedPriceStats(cars []Car, positions []int) *PriceStats {
+	stats := &PriceStats{Cars: len(positions)}
+	var sum float64
+	for _, i := range positions {
+		stats.Count += cars[i].VehicleCount
+		sum += float64(cars[i].Price) * float64(cars[i].VehicleCount)
+	}
+	if stats.Count == 0 {
+		return stats
+	}
+	stats.Mean = sum / float64(stats.Count)
+
+	var squares float64
+	for _, i := range positions {
+		d := float64(cars[i].Price) - stats.Mean
+		squares += d * d * float64(cars[i].VehicleCount)
+	}
+	stats.StdDev = math.Sqrt(squares / float64(stats.Count))
+
+	percentiles := []struct {
+		rank  float64
+		value *float32
+	}{
+		{0.10, &stats.P10},
+		{0.25, &stats.P25},
+		{0.50, &stats.Median},
+		{0.75, &stats.P75},
+		{0.90, &stats.P90},
+	}
+	// A percentile is the price of the first vehicle at or past its rank
+	next, seen := 0, 0
+	for _, i := range positions {
+		seen += cars[i].VehicleCount
+		for next < len(percentiles) && float64(seen) >= percentiles[next].rank*float64(stats.Count) {
+			*percentiles[next].value = cars[i].Price
+			next++
+		}
+	}
+	return stats
+}
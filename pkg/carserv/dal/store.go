@@ -0,0 +1,438 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned when a car does not exist in a store
+	ErrNotFound = errors.New("car not found")
+	// ErrDuplicateID is returned when a car ID is already taken
+	ErrDuplicateID = errors.New("duplicate car id")
+	// ErrVersionConflict is returned when a write expected a different
+	// version of a car than the one in the store
+	ErrVersionConflict = errors.New("car version conflict")
+)
+
+// CarStore defines a repository of cars the server can query and update
+type CarStore interface {
+	// List returns a copy of up to limit cars starting at offset
+	List(offset, limit int) []Car
+	// Get returns the car with the given ID
+	Get(id int) (Car, error)
+	// Count returns the number of cars in the store
+	Count() int
+	// Snapshot returns a point-in-time view of every car in the store
+	Snapshot() *Snapshot
+	// Create adds a car to the store, assigning it a new version and an ID
+	// unless it has one
+	Create(car Car) (Car, error)
+	// Update replaces the car with the given ID by the result of fn, which
+	// is called with the current car while writes are locked out, and
+	// assigns it a new version
+	Update(id int, fn func(Car) (Car, error)) (Car, error)
+	// Delete removes the car with the given ID once check, called with the
+	// current car while writes are locked out, returns no error
+	Delete(id int, check func(Car) error) error
+	// Upsert writes a batch of cars, updating the car with the same ID or,
+	// for cars without an ID, the same make, model and year, and creating
+	// the others. Results are returned in the order of cars.
+	Upsert(cars []Car) []UpsertResult
+}
+
+// Snapshot defines a point-in-time view of the cars of a store along with
+// their indexes. It is shared by every reader and must not be modified.
+type Snapshot struct {
+	Cars  []Car
+	Index *Index
+}
+
+// NewSnapshot returns a snapshot of cars, building their indexes
+func NewSnapshot(cars []Car) *Snapshot {
+	return &Snapshot{Cars: cars, Index: NewIndex(cars)}
+}
+
+// UpsertResult defines the outcome of writing a single car of a batch
+type UpsertResult struct {
+	Car     Car
+	Created bool
+	Err     error
+}
+
+// carKey identifies cars by make, model and year for upserts
+type carKey struct {
+	make  string
+	model string
+	year  int
+}
+
+func keyOf(car Car) carKey {
+	return carKey{make: car.Make, model: car.Model, year: car.Year}
+}
+
+// Replacer is implemented by stores whose whole dataset can be swapped
+type Replacer interface {
+	// Replace atomically swaps the dataset served by the store
+	Replace(cars []Car) error
+}
+
+// MemoryStore defines an in-memory CarStore backed by a slice. Cars in the
+// slice are never modified in place, readers holding a snapshot keep a
+// consistent view while writes and Replace swap in a new one.
+//
+// Versions are drawn from a single counter, so a car never gets back a
+// version it had before, even across Replace.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	cars    []Car
+	byID    map[int]int
+	byKey   map[carKey]int
+	index   *Index
+	nextID  int
+	version int
+	journal journal
+}
+
+// mutation defines a single write to a MemoryStore. Seq is the store
+// version after the write, for puts it is also the version of the car.
+type mutation struct {
+	Seq    int
+	Car    Car
+	Delete bool
+}
+
+// journal persists mutations before a MemoryStore applies them
+type journal interface {
+	record(mutations []mutation) error
+}
+
+// NewMemoryStore returns a new in-memory store serving the given cars. Cars
+// without an ID are numbered after the highest ID given. It panics if two
+// cars share an ID.
+func NewMemoryStore(cars []Car) *MemoryStore {
+	s := &MemoryStore{}
+	if err := s.Replace(cars); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// NewDefaultStore returns an in-memory store serving CarsDataset
+func NewDefaultStore() *MemoryStore {
+	return NewMemoryStore(CarsDataset)
+}
+
+// List returns a copy of up to limit cars starting at offset
+func (s *MemoryStore) List(offset, limit int) []Car {
+	cars := s.Snapshot().Cars
+	if offset < 0 || offset >= len(cars) || limit <= 0 {
+		return []Car{}
+	}
+	end := offset + limit
+	if end > len(cars) {
+		end = len(cars)
+	}
+	result := make([]Car, end-offset)
+	copy(result, cars[offset:end])
+	return result
+}
+
+// Get returns the car with the given ID
+func (s *MemoryStore) Get(id int) (Car, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return Car{}, ErrNotFound
+	}
+	return s.cars[i], nil
+}
+
+// Count returns the number of cars in the store
+func (s *MemoryStore) Count() int {
+	return len(s.Snapshot().Cars)
+}
+
+// Snapshot returns every car in the store along with their indexes
+func (s *MemoryStore) Snapshot() *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Snapshot{Cars: s.cars, Index: s.index}
+}
+
+// Create adds a car to the store
+func (s *MemoryStore) Create(car Car) (Car, error) {
+	if err := car.Validate(); err != nil {
+		return Car{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byID[car.ID]; ok {
+		return Car{}, fmt.Errorf("%w: %d", ErrDuplicateID, car.ID)
+	}
+	if car.ID == 0 {
+		car.ID = s.nextID
+	}
+	car.Version = s.version + 1
+
+	if err := s.commit([]mutation{{Seq: car.Version, Car: car}}); err != nil {
+		return Car{}, err
+	}
+	return car, nil
+}
+
+// Update replaces the car with the given ID by the result of fn
+func (s *MemoryStore) Update(id int, fn func(Car) (Car, error)) (Car, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return Car{}, ErrNotFound
+	}
+
+	car, err := fn(s.cars[i])
+	if err != nil {
+		return Car{}, err
+	}
+	car.ID = id
+	if err := car.Validate(); err != nil {
+		return Car{}, err
+	}
+	car.Version = s.version + 1
+
+	if err := s.commit([]mutation{{Seq: car.Version, Car: car}}); err != nil {
+		return Car{}, err
+	}
+	return car, nil
+}
+
+// Delete removes the car with the given ID
+func (s *MemoryStore) Delete(id int, check func(Car) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if check != nil {
+		if err := check(s.cars[i]); err != nil {
+			return err
+		}
+	}
+
+	return s.commit([]mutation{{Seq: s.version + 1, Car: Car{ID: id}, Delete: true}})
+}
+
+// Upsert writes a batch of cars under a single lock, copying the dataset at
+// most once per batch
+func (s *MemoryStore) Upsert(cars []Car) []UpsertResult {
+	results := make([]UpsertResult, len(cars))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Plan the batch against the store and the cars created earlier in it
+	nextID, version := s.nextID, s.version
+	createdIDs := make(map[int]bool)
+	createdKeys := make(map[carKey]int)
+	var mutations []mutation
+	var planned []int
+	for j, car := range cars {
+		if err := car.Validate(); err != nil {
+			results[j].Err = err
+			continue
+		}
+
+		key := keyOf(car)
+		if car.ID == 0 {
+			if id, ok := createdKeys[key]; ok {
+				car.ID = id
+			} else {
+				car.ID = s.byKey[key]
+			}
+		}
+		_, exists := s.byID[car.ID]
+		exists = exists || createdIDs[car.ID]
+		if car.ID == 0 {
+			car.ID = nextID
+		}
+		if car.ID >= nextID {
+			nextID = car.ID + 1
+		}
+		if !exists {
+			createdIDs[car.ID] = true
+			createdKeys[key] = car.ID
+		}
+		version++
+		car.Version = version
+
+		results[j] = UpsertResult{Car: car, Created: !exists}
+		mutations = append(mutations, mutation{Seq: version, Car: car})
+		planned = append(planned, j)
+	}
+
+	if err := s.commit(mutations); err != nil {
+		for _, j := range planned {
+			results[j] = UpsertResult{Err: err}
+		}
+	}
+	return results
+}
+
+// commit records mutations in the journal, if any, and applies them. It must
+// be called with mu held for writing.
+func (s *MemoryStore) commit(mutations []mutation) error {
+	if len(mutations) == 0 {
+		return nil
+	}
+	if s.journal != nil {
+		if err := s.journal.record(mutations); err != nil {
+			return err
+		}
+	}
+	s.apply(mutations)
+	return nil
+}
+
+// apply writes mutations to the store, copying the dataset at most once, and
+// updates the indexes. A delete moves the last car into the position of the
+// deleted one, so that only their positions change. It must be called with
+// mu held for writing.
+func (s *MemoryStore) apply(mutations []mutation) {
+	copied := false
+	own := func() {
+		if !copied {
+			cars := make([]Car, len(s.cars))
+			copy(cars, s.cars)
+			s.cars = cars
+			copied = true
+		}
+	}
+	index := newIndexWriter(s.index)
+	for _, m := range mutations {
+		if m.Seq > s.version {
+			s.version = m.Seq
+		}
+		i, exists := s.byID[m.Car.ID]
+
+		if m.Delete {
+			if !exists {
+				continue
+			}
+			if key := keyOf(s.cars[i]); s.byKey[key] == m.Car.ID {
+				delete(s.byKey, key)
+			}
+			delete(s.byID, m.Car.ID)
+
+			own()
+			index.remove(i, s.cars[i])
+			if last := len(s.cars) - 1; i != last {
+				moved := s.cars[last]
+				index.remove(last, moved)
+				index.add(i, moved)
+				s.cars[i] = moved
+				s.byID[moved.ID] = i
+			}
+			s.cars = s.cars[:len(s.cars)-1]
+			continue
+		}
+
+		if m.Car.ID >= s.nextID {
+			s.nextID = m.Car.ID + 1
+		}
+		if !exists {
+			// Appending never touches the part of the array visible to
+			// snapshots
+			s.byID[m.Car.ID] = len(s.cars)
+			s.byKey[keyOf(m.Car)] = m.Car.ID
+			s.cars = append(s.cars, m.Car)
+			index.add(len(s.cars)-1, m.Car)
+			continue
+		}
+
+		own()
+		if key := keyOf(s.cars[i]); s.byKey[key] == m.Car.ID {
+			delete(s.byKey, key)
+		}
+		s.byKey[keyOf(m.Car)] = m.Car.ID
+		index.remove(i, s.cars[i])
+		index.add(i, m.Car)
+		s.cars[i] = m.Car
+	}
+	s.index = index.ix
+}
+
+// Replace swaps the cars served by the store. Cars without an ID keep the ID
+// of the car of the same make, model and year, if any.
+func (s *MemoryStore) Replace(cars []Car) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replace(cars)
+}
+
+// replace must be called with mu held for writing
+func (s *MemoryStore) replace(cars []Car) error {
+	next := make([]Car, len(cars))
+	copy(next, cars)
+
+	byID := make(map[int]int, len(next))
+	byKey := make(map[carKey]int, len(next))
+	// IDs are never handed out twice, even to the cars of another dataset
+	nextID := 1
+	if s.nextID > nextID {
+		nextID = s.nextID
+	}
+	taken := make(map[int]bool, len(next))
+	for _, car := range next {
+		if car.ID >= nextID {
+			nextID = car.ID + 1
+		}
+		taken[car.ID] = true
+	}
+	// Cars without an ID keep the ID of the car of the same make, model and
+	// year, so that a dataset without IDs keeps them across reloads
+	for i := range next {
+		if next[i].ID != 0 {
+			continue
+		}
+		if id, ok := s.byKey[keyOf(next[i])]; ok && !taken[id] {
+			next[i].ID = id
+			taken[id] = true
+		}
+	}
+	for i := range next {
+		if next[i].ID == 0 {
+			next[i].ID = nextID
+			nextID++
+		}
+		if _, ok := byID[next[i].ID]; ok {
+			return fmt.Errorf("%w: %d", ErrDuplicateID, next[i].ID)
+		}
+		byID[next[i].ID] = i
+		byKey[keyOf(next[i])] = next[i].ID
+	}
+
+	s.version++
+	for i := range next {
+		next[i].Version = s.version
+	}
+	s.cars = next
+	s.byID = byID
+	s.byKey = byKey
+	index := NewIndex(next)
+	if s.index != nil {
+		// Autocomplete keeps serving the previous cars until the new ones
+		// are completed
+		index.lineage, index.generation = s.index.lineage, s.index.generation+1
+	}
+	s.index = index
+	s.nextID = nextID
+	return nil
+}
@@ -0,0 +1,163 @@
+package dal
+
+import (
+	"sort"
+	"sync"
+)
+
+// MaxCompletions limits the completions kept for each prefix
+const MaxCompletions = 20
+
+// Completion defines a make or model completing a prefix along with its
+// number of vehicles
+type Completion struct {
+	Value    string `json:"value"`
+	Vehicles int    `json:"vehicles"`
+}
+
+// Trie defines a prefix trie of folded terms. Each node holds the best
+// completions of its prefix, most vehicles first, so that a lookup only
+// walks the prefix.
+type Trie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	top      []Completion
+}
+
+// NewTrie builds the trie of the vehicles of each term
+func NewTrie(vehicles map[string]int) *Trie {
+	completions := make([]Completion, 0, len(vehicles))
+	for value, count := range vehicles {
+		completions = append(completions, Completion{Value: value, Vehicles: count})
+	}
+	sort.Slice(completions, func(a, b int) bool {
+		if completions[a].Vehicles != completions[b].Vehicles {
+			return completions[a].Vehicles > completions[b].Vehicles
+		}
+		return completions[a].Value < completions[b].Value
+	})
+
+	// Terms are inserted best first, each node keeps the first ones
+	t := &Trie{root: &trieNode{}}
+	for _, completion := range completions {
+		node := t.root
+		node.keep(completion)
+		for _, r := range Fold(completion.Value) {
+			child := node.children[r]
+			if child == nil {
+				if node.children == nil {
+					node.children = make(map[rune]*trieNode)
+				}
+				child = &trieNode{}
+				node.children[r] = child
+			}
+			node = child
+			node.keep(completion)
+		}
+	}
+	return t
+}
+
+func (n *trieNode) keep(completion Completion) {
+	if len(n.top) < MaxCompletions {
+		n.top = append(n.top, completion)
+	}
+}
+
+// Complete returns up to limit terms starting with prefix once folded, most
+// vehicles first. The returned slice is shared and must not be modified.
+func (t *Trie) Complete(prefix string, limit int) []Completion {
+	node := t.root
+	for _, r := range Fold(prefix) {
+		if node = node.children[r]; node == nil {
+			return nil
+		}
+	}
+	if limit < len(node.top) {
+		return node.top[:limit]
+	}
+	return node.top
+}
+
+// Completions defines the prefix tries of the makes and models of a
+// snapshot, ModelsByMake holding the models of each folded make
+type Completions struct {
+	Makes        *Trie
+	Models       *Trie
+	ModelsByMake map[string]*Trie
+}
+
+// NewCompletions builds the prefix tries of the makes and models of cars
+func NewCompletions(cars []Car) *Completions {
+	makes := make(map[string]int)
+	models := make(map[string]int)
+	modelsByMake := make(map[string]map[string]int)
+	for _, car := range cars {
+		makes[car.Make] += car.VehicleCount
+		models[car.Model] += car.VehicleCount
+		key := Fold(car.Make)
+		if modelsByMake[key] == nil {
+			modelsByMake[key] = make(map[string]int)
+		}
+		modelsByMake[key][car.Model] += car.VehicleCount
+	}
+
+	c := &Completions{
+		Makes:        NewTrie(makes),
+		Models:       NewTrie(models),
+		ModelsByMake: make(map[string]*Trie, len(modelsByMake)),
+	}
+	for key, vehicles := range modelsByMake {
+		c.ModelsByMake[key] = NewTrie(vehicles)
+	}
+	return c
+}
+
+// completionsCache holds the completions last built for a lineage of
+// indexes, the indexes derived from one another by writes
+type completionsCache struct {
+	mu sync.Mutex
+	// latest are the completions of the most recent index built, of the
+	// given generation
+	latest     *Completions
+	generation int
+	building   bool
+}
+
+// Completions returns the prefix tries of the makes and models of the
+// snapshot, shared by every snapshot of its index. Until they are built in
+// the background, the completions last built for an earlier index derived
+// into this one are returned. Only the first snapshot of a store waits for
+// its completions to be built.
+func (s *Snapshot) Completions() *Completions {
+	ix, c := s.Index, s.Index.lineage
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ix.completions != nil {
+		return ix.completions
+	}
+	if c.latest == nil {
+		ix.completions = NewCompletions(s.Cars)
+		c.latest, c.generation = ix.completions, ix.generation
+		return ix.completions
+	}
+	if !c.building {
+		c.building = true
+		go func() {
+			built := NewCompletions(s.Cars)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			ix.completions = built
+			if ix.generation >= c.generation {
+				c.latest, c.generation = built, ix.generation
+			}
+			c.building = false
+		}()
+	}
+	return c.latest
+}
@@ -0,0 +1,104 @@
+package dal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompletions(t *testing.T) {
+	snap := NewSnapshot([]Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+		{Make: "Ford", Model: "F-150", Year: 2020, VehicleCount: 6, Price: 34000},
+		{Make: "Ford", Model: "Focus", Year: 2017, VehicleCount: 3, Price: 15000},
+		{Make: "Fiat", Model: "500", Year: 2019, VehicleCount: 12, Price: 14000},
+		{Make: "Honda", Model: "Fit", Year: 2019, VehicleCount: 7, Price: 21000},
+	})
+	completions := snap.Completions()
+
+	tests := []struct {
+		name     string
+		trie     *Trie
+		prefix   string
+		limit    int
+		expected []Completion
+	}{
+		{
+			name:     "Makes",
+			trie:     completions.Makes,
+			prefix:   "f",
+			limit:    10,
+			expected: []Completion{{Value: "Ford", Vehicles: 19}, {Value: "Fiat", Vehicles: 12}},
+		},
+		{
+			name:     "Every make",
+			trie:     completions.Makes,
+			limit:    10,
+			expected: []Completion{{Value: "Ford", Vehicles: 19}, {Value: "Fiat", Vehicles: 12}, {Value: "Honda", Vehicles: 7}},
+		},
+		{
+			name:     "Models",
+			trie:     completions.Models,
+			prefix:   "F",
+			limit:    2,
+			expected: []Completion{{Value: "F-150", Vehicles: 16}, {Value: "Fit", Vehicles: 7}},
+		},
+		{
+			name:     "Models of a make",
+			trie:     completions.ModelsByMake["ford"],
+			prefix:   "FO",
+			limit:    10,
+			expected: []Completion{{Value: "Focus", Vehicles: 3}},
+		},
+		{
+			name:   "No completion",
+			trie:   completions.Makes,
+			prefix: "fz",
+			limit:  10,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.trie.Complete(tc.prefix, tc.limit); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, got)
+			}
+		})
+	}
+
+	if snap.Completions() != completions {
+		t.Error("Expected completions to be built once per snapshot index")
+	}
+}
+
+func TestCompletionsRebuiltInBackground(t *testing.T) {
+	store := NewMemoryStore([]Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+	})
+	previous := store.Snapshot().Completions()
+	if _, err := store.Create(Car{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 3, Price: 18000}); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := store.Snapshot()
+	if snap.Completions() != previous {
+		t.Fatal("Expected the previous completions while the new ones are built")
+	}
+	expected := []Completion{{Value: "Kia", Vehicles: 3}}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		got := snap.Completions().Makes.Complete("k", 10)
+		if reflect.DeepEqual(got, expected) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected: %v, Got: %v", expected, got)
+		}
+	}
+}
+
+func BenchmarkComplete(b *testing.B) {
+	completions := NewSnapshot(CarsDataset).Completions()
+	for i := 0; i < b.N; i++ {
+		completions.Models.Complete("c", 10)
+	}
+}
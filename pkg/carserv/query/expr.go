@@ -0,0 +1,227 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// Expr defines a parsed query
+type Expr interface {
+	// Match reports whether car matches the query
+	Match(car dal.Car) bool
+	// Positions returns the sorted positions of the cars of snap matching
+	// the query, looked up in the snapshot indexes where possible
+	Positions(snap *dal.Snapshot) []int
+	String() string
+}
+
+// And returns the conjunction of exprs, skipping nil ones. It returns nil
+// when every expr is nil.
+func And(exprs ...Expr) Expr {
+	var result Expr
+	for _, expr := range exprs {
+		switch {
+		case expr == nil:
+		case result == nil:
+			result = expr
+		default:
+			result = &andExpr{left: result, right: expr}
+		}
+	}
+	return result
+}
+
+// Compare returns a term comparing a numeric field with number using op,
+// one of :, =, !=, <, <=, > or >=
+func Compare(field, op string, number float32) Expr {
+	return &termExpr{field: field, op: op, text: strconv.FormatFloat(float64(number), 'f', -1, 32), number: number}
+}
+
+// MapText returns expr with the value of each make and model term replaced
+// by fn(field, value), such as the canonical make of an alias
+func MapText(expr Expr, fn func(field, text string) string) Expr {
+	switch e := expr.(type) {
+	case *andExpr:
+		return &andExpr{left: MapText(e.left, fn), right: MapText(e.right, fn)}
+	case *orExpr:
+		return &orExpr{left: MapText(e.left, fn), right: MapText(e.right, fn)}
+	case *notExpr:
+		return &notExpr{expr: MapText(e.expr, fn)}
+	case *termExpr:
+		if e.field == FieldMake || e.field == FieldModel {
+			term := *e
+			term.text = fn(e.field, e.text)
+			return &term
+		}
+	}
+	return expr
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e *andExpr) Match(car dal.Car) bool {
+	return e.left.Match(car) && e.right.Match(car)
+}
+
+func (e *andExpr) Positions(snap *dal.Snapshot) []int {
+	left := e.left.Positions(snap)
+	if len(left) == 0 {
+		return nil
+	}
+	return dal.Intersect(left, e.right.Positions(snap))
+}
+
+func (e *andExpr) String() string {
+	return fmt.Sprintf("(%s AND %s)", e.left, e.right)
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e *orExpr) Match(car dal.Car) bool {
+	return e.left.Match(car) || e.right.Match(car)
+}
+
+func (e *orExpr) Positions(snap *dal.Snapshot) []int {
+	return dal.Union(e.left.Positions(snap), e.right.Positions(snap))
+}
+
+func (e *orExpr) String() string {
+	return fmt.Sprintf("(%s OR %s)", e.left, e.right)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e *notExpr) Match(car dal.Car) bool {
+	return !e.expr.Match(car)
+}
+
+// Positions returns the complement of the positions of the negated query
+func (e *notExpr) Positions(snap *dal.Snapshot) []int {
+	excluded := e.expr.Positions(snap)
+	var result []int
+	for i := range snap.Cars {
+		if len(excluded) > 0 && excluded[0] == i {
+			excluded = excluded[1:]
+			continue
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+func (e *notExpr) String() string {
+	return fmt.Sprintf("NOT %s", e.expr)
+}
+
+// termExpr compares a field with a value, number holds the value of numeric
+// fields
+type termExpr struct {
+	field  string
+	op     string
+	text   string
+	number float32
+}
+
+func (e *termExpr) Match(car dal.Car) bool {
+	switch e.field {
+	case FieldMake:
+		return matchText(car.Make, e.op, e.text)
+	case FieldModel:
+		return matchText(car.Model, e.op, e.text)
+	case FieldYear:
+		return matchNumber(float32(car.Year), e.op, e.number)
+	case FieldPrice:
+		return matchNumber(car.Price, e.op, e.number)
+	case FieldVehicleCount:
+		return matchNumber(float32(car.VehicleCount), e.op, e.number)
+	}
+	return false
+}
+
+func (e *termExpr) Positions(snap *dal.Snapshot) []int {
+	switch {
+	case e.field == FieldMake && e.op == ":":
+		return snap.Index.MakeContains(e.text)
+	case e.field == FieldModel && e.op == ":":
+		return snap.Index.ModelContains(e.text)
+	case e.field == FieldYear && (e.op == ":" || e.op == "="):
+		return snap.Index.Year(int(e.number))
+	case e.field == FieldPrice && e.op != "!=":
+		low, high := priceBounds(e.op, e.number)
+		positions := snap.Index.PriceRange(low, high)
+		sort.Ints(positions)
+		return positions
+	}
+
+	var result []int
+	for i, car := range snap.Cars {
+		if e.Match(car) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+func (e *termExpr) String() string {
+	if e.field == FieldMake || e.field == FieldModel {
+		return fmt.Sprintf("%s%s%q", e.field, e.op, e.text)
+	}
+	return fmt.Sprintf("%s%s%s", e.field, e.op, e.text)
+}
+
+func matchText(value, op, text string) bool {
+	switch op {
+	case ":":
+		return strings.Contains(value, text)
+	case "=":
+		return value == text
+	case "!=":
+		return value != text
+	}
+	return false
+}
+
+func matchNumber(value float32, op string, number float32) bool {
+	switch op {
+	case ":", "=":
+		return value == number
+	case "!=":
+		return value != number
+	case "<":
+		return value < number
+	case "<=":
+		return value <= number
+	case ">":
+		return value > number
+	case ">=":
+		return value >= number
+	}
+	return false
+}
+
+// priceBounds returns the exclusive price bounds of a price comparison
+func priceBounds(op string, number float32) (float32, float32) {
+	lowest, highest := float32(math.Inf(-1)), float32(math.Inf(1))
+	switch op {
+	case "<":
+		return lowest, number
+	case "<=":
+		return lowest, math.Nextafter32(number, highest)
+	case ">":
+		return number, highest
+	case ">=":
+		return math.Nextafter32(number, lowest), highest
+	}
+	return math.Nextafter32(number, lowest), math.Nextafter32(number, highest)
+}
@@ -0,0 +1,199 @@
+// Package query implements the boolean query language of car searches, such
+// as make:Ford AND (year>=2019 OR price<30000) AND NOT model:Van.
+//
+// A term compares a field with a value. make and model support : (contains),
+// = and !=, year, price and vehicle_count also support <, <=, > and >=, where
+// : means equality. Terms are combined with AND, OR and NOT, from the
+// tightest binding to the loosest NOT, AND, OR, and grouped with parentheses.
+// Values holding spaces or operators are quoted, as in model:"Transit Van".
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fields of a query term
+const (
+	FieldMake         = "make"
+	FieldModel        = "model"
+	FieldYear         = "year"
+	FieldPrice        = "price"
+	FieldVehicleCount = "vehicle_count"
+)
+
+// SyntaxError defines a malformed query and the position, counted in
+// characters from 1, it was found at
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse parses a query
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, &SyntaxError{Pos: 1, Msg: "empty query"}
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		if tok.kind == tokenRParen {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "unbalanced )"}
+		}
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected AND, OR or the end of the query, found %q", tok.text)}
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is the given keyword, keywords are
+// case insensitive
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, word)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.advance()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.keyword("NOT") {
+		p.advance()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: fmt.Sprintf("expected ) to close the ( at position %d", tok.pos)}
+		}
+		return expr, nil
+	case tokenWord:
+		if isKeyword(tok.text) {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected a term, found %s", strings.ToUpper(tok.text))}
+		}
+		return p.parseTerm(tok)
+	case tokenEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected end of query, expected a term"}
+	}
+	return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected a term, found %q", tok.text)}
+}
+
+func (p *parser) parseTerm(field token) (Expr, error) {
+	name := strings.ToLower(field.text)
+	numeric := false
+	switch name {
+	case FieldMake, FieldModel:
+	case FieldYear, FieldPrice, FieldVehicleCount:
+		numeric = true
+	default:
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("unknown field %q, expected make, model, year, price or vehicle_count", field.text)}
+	}
+
+	op := p.advance()
+	if op.kind != tokenOperator {
+		return nil, &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("expected an operator after %s", name)}
+	}
+	if !numeric && op.text != ":" && op.text != "=" && op.text != "!=" {
+		return nil, &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("operator %s is not supported by %s, expected :, = or !=", op.text, name)}
+	}
+
+	value := p.advance()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("expected a value after %s%s", name, op.text)}
+	}
+
+	term := &termExpr{field: name, op: op.text, text: value.text}
+	if !numeric {
+		return term, nil
+	}
+
+	var err error
+	if name == FieldPrice {
+		var price float64
+		price, err = strconv.ParseFloat(value.text, 32)
+		term.number = float32(price)
+	} else {
+		var number int
+		number, err = strconv.Atoi(value.text)
+		term.number = float32(number)
+	}
+	if err != nil {
+		return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("invalid %s value %q", name, value.text)}
+	}
+	return term, nil
+}
+
+func isKeyword(word string) bool {
+	return strings.EqualFold(word, "AND") || strings.EqualFold(word, "OR") || strings.EqualFold(word, "NOT")
+}
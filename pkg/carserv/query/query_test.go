@@ -0,0 +1,171 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Precedence",
+			input:    "make:Ford AND (year>=2019 OR price<30000) AND NOT model:Van",
+			expected: `((make:"Ford" AND (year>=2019 OR price<30000)) AND NOT model:"Van")`,
+		},
+		{
+			name:     "AndBindsTighter",
+			input:    "make:Kia or make:Ford and year=2020",
+			expected: `(make:"Kia" OR (make:"Ford" AND year=2020))`,
+		},
+		{
+			name:     "Quoted",
+			input:    `model:"Transit Van" AND vehicle_count != 0`,
+			expected: `(model:"Transit Van" AND vehicle_count!=0)`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expr.String() != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, expr.String())
+			}
+		})
+	}
+}
+
+func TestMapText(t *testing.T) {
+	expr, err := Parse("make:Chevy AND NOT (model:F150 OR year=2019)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical := map[string]string{"Chevy": "Chevrolet", "F150": "F-150"}
+	mapped := MapText(expr, func(field, text string) string {
+		return field + "=" + canonical[text]
+	})
+
+	expected := `(make:"make=Chevrolet" AND NOT (model:"model=F-150" OR year=2019))`
+	if mapped.String() != expected {
+		t.Errorf("Expected: %v, Got: %v", expected, mapped.String())
+	}
+	if expected := `(make:"Chevy" AND NOT (model:"F150" OR year=2019))`; expr.String() != expected {
+		t.Errorf("Expected the query unchanged: %v, Got: %v", expected, expr.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "UnknownField",
+			input:    "make:Ford AND colour:red",
+			expected: `position 15: unknown field "colour", expected make, model, year, price or vehicle_count`,
+		},
+		{
+			name:     "MissingValue",
+			input:    "year>=",
+			expected: "position 7: expected a value after year>=",
+		},
+		{
+			name:     "InvalidNumber",
+			input:    "price<cheap",
+			expected: `position 7: invalid price value "cheap"`,
+		},
+		{
+			name:     "TextOperator",
+			input:    "make>Ford",
+			expected: "position 5: operator > is not supported by make, expected :, = or !=",
+		},
+		{
+			name:     "Unclosed",
+			input:    "(make:Ford OR make:Kia",
+			expected: "position 23: expected ) to close the ( at position 1",
+		},
+		{
+			name:     "Unbalanced",
+			input:    "make:Ford)",
+			expected: "position 10: unbalanced )",
+		},
+		{
+			name:     "MissingOperator",
+			input:    "make:Ford year:2020",
+			expected: `position 11: expected AND, OR or the end of the query, found "year"`,
+		},
+		{
+			name:     "DanglingKeyword",
+			input:    "make:Ford AND",
+			expected: "position 14: unexpected end of query, expected a term",
+		},
+		{
+			name:     "Unterminated",
+			input:    `model:"Transit`,
+			expected: "position 7: unterminated quoted value",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestPositions(t *testing.T) {
+	snap := dal.NewSnapshot([]dal.Car{
+		{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+		{Make: "Ford", Model: "Transit Van", Year: 2020, VehicleCount: 4, Price: 42000},
+		{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+		{Make: "Ford", Model: "Focus", Year: 2017, VehicleCount: 0, Price: 15000},
+	})
+
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{input: "make:Ford AND (year>=2019 OR price<30000) AND NOT model:Van", expected: []int{0, 3}},
+		{input: "price<=30000 AND price>21000", expected: []int{0}},
+		{input: "price=21000 OR year:2017", expected: []int{2, 3}},
+		{input: "NOT make=Ford", expected: []int{2}},
+		{input: "vehicle_count>0 AND model!=Civic", expected: []int{0, 1}},
+		{input: "make:Volvo", expected: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			expr, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := expr.Positions(snap)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, got)
+			}
+
+			var matched []int
+			for i, car := range snap.Cars {
+				if expr.Match(car) {
+					matched = append(matched, i)
+				}
+			}
+			if !reflect.DeepEqual(matched, tc.expected) {
+				t.Errorf("Expected Match to agree with Positions: %v, Got: %v", tc.expected, matched)
+			}
+		})
+	}
+}
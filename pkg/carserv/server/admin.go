@@ -0,0 +1,32 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Reload defines a POST handler to reload the dataset file
+func (h *httpServer) Reload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	status, err := h.reloader.Reload()
+	if err != nil {
+		h.log.Printf("dataset reload failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.log.Printf("failed to encode reload status: %v", err)
+	}
+}
+
+// GetReloadStatus defines a GET handler to fetch the outcome of the last reload
+func (h *httpServer) GetReloadStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(h.reloader.Status()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// Formats of an aggregation response
+const (
+	tableJSON = "json"
+	tableCSV  = "csv"
+)
+
+// GetAggregate defines a GET handler computing the metrics of the cars
+// matching the search filters, grouped by the group_by fields
+func (h *httpServer) GetAggregate(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	params, err := h.parseSearch(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.match == "" {
+		params.match = matchAll
+	}
+
+	aggregation, err := dal.ParseAggregation(vars.Get("group_by"), vars.Get("metrics"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	format, err := tableFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	snap := h.store.Snapshot()
+	table, err := aggregation.Run(ctx, snap.Cars, inPriceOrder(snap, matching(snap, params)))
+	if err != nil {
+		h.writeProcessorError(w, r, err)
+		return
+	}
+
+	if format == tableCSV {
+		writeCSV(w, table)
+		return
+	}
+	writeJSON(w, http.StatusOK, table)
+}
+
+// tableFormat returns the format of an aggregation response, given by the
+// format query parameter or the Accept header, JSON by default
+func tableFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		switch format = strings.ToLower(format); format {
+		case tableJSON, tableCSV:
+			return format, nil
+		}
+		return "", fmt.Errorf("format must be %s or %s: %s", tableJSON, tableCSV, format)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == "text/csv" {
+			return tableCSV, nil
+		}
+	}
+	return tableJSON, nil
+}
+
+// writeCSV writes a table as CSV, a header row of the columns followed by
+// the rows
+func writeCSV(w http.ResponseWriter, table dal.Table) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(table.Columns)
+	record := make([]string, len(table.Columns))
+	for _, row := range table.Rows {
+		for k, value := range row {
+			record[k] = formatCell(value)
+		}
+		out.Write(record)
+	}
+	out.Flush()
+}
+
+// formatCell formats a table value without exponents
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
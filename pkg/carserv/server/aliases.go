@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// aliasRecord defines the body of an alias edit
+type aliasRecord struct {
+	Canonical string `json:"canonical"`
+}
+
+// GetAliases defines a GET handler listing the make and model aliases
+func (h *httpServer) GetAliases(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.aliases.Aliases())
+}
+
+// SetAlias defines a PUT handler making an alias stand for a canonical make
+// or model, replacing the alias folding the same way if any. Like every admin
+// endpoint it is unauthenticated and internal only.
+func (h *httpServer) SetAlias(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var record aliasRecord
+	if err := decodeBody(w, r, &record); err != nil {
+		h.log.Printf("alias decoding failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.aliases.Set(vars["kind"], vars["alias"], record.Canonical); err != nil {
+		h.writeAliasError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.aliases.Aliases())
+}
+
+// DeleteAlias defines a DELETE handler removing a make or model alias. Like
+// every admin endpoint it is unauthenticated and internal only.
+func (h *httpServer) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if err := h.aliases.Delete(vars["kind"], vars["alias"]); err != nil {
+		h.writeAliasError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAliasError maps alias catalog errors onto HTTP status codes
+func (h *httpServer) writeAliasError(w http.ResponseWriter, err error) {
+	var fieldErr *dal.FieldError
+	switch {
+	case errors.Is(err, dal.ErrAliasNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.As(err, &fieldErr):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		h.log.Printf("alias edit failed: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// defaultCompletions is the number of completions unless set by a request
+const defaultCompletions = 10
+
+// Fields completed by the autocomplete endpoint
+const (
+	completeMake  = "make"
+	completeModel = "model"
+)
+
+// completions defines the makes or models completing a prefix, most
+// vehicles first
+type completions struct {
+	Field       string           `json:"field"`
+	Prefix      string           `json:"prefix"`
+	Completions []dal.Completion `json:"completions"`
+}
+
+// GetAutocomplete defines a GET handler completing a prefix into the makes
+// or models of the inventory, whatever their case and diacritics. Models
+// may be narrowed to those of a make.
+func (h *httpServer) GetAutocomplete(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	field := vars.Get("field")
+	switch field {
+	case "":
+		field = completeMake
+	case completeMake, completeModel:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("field must be %s or %s: %s", completeMake, completeModel, field))
+		return
+	}
+	makeName := vars.Get("make")
+	if makeName != "" && field != completeModel {
+		writeError(w, http.StatusBadRequest, errors.New("make only applies to field=model"))
+		return
+	}
+	limit, err := parseLimit(vars, defaultCompletions, dal.MaxCompletions)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tries := h.store.Snapshot().Completions()
+	trie := tries.Makes
+	switch {
+	case makeName != "":
+		trie = tries.ModelsByMake[dal.Fold(h.aliases.Canonical(dal.AliasMakes, makeName))]
+	case field == completeModel:
+		trie = tries.Models
+	}
+
+	result := completions{Field: field, Prefix: vars.Get("prefix"), Completions: []dal.Completion{}}
+	if trie != nil {
+		result.Completions = append(result.Completions, trie.Complete(result.Prefix, limit)...)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
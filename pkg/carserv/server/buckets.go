@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultBucketWidth is the width of price buckets unless set by a request
+	defaultBucketWidth = 10000
+	// maxPriceBuckets limits the number of buckets of a response
+	maxPriceBuckets = 1000
+	// maxBucketIndex bounds the fixed width bucket of a price, so that
+	// narrow buckets cannot overflow bucket indexes
+	maxBucketIndex = math.MaxInt32
+)
+
+// priceBuckets defines how prices are bucketed, either by a fixed width from
+// 0 or between ascending edges, the last bucket being open ended
+type priceBuckets struct {
+	width float32
+	edges []float32
+}
+
+// priceBucket defines the prices from Min up to Max excluded, or without
+// bound when Max is nil
+type priceBucket struct {
+	Min      float32  `json:"min"`
+	Max      *float32 `json:"max,omitempty"`
+	Cars     int      `json:"cars"`
+	Vehicles int      `json:"vehicles"`
+}
+
+// parsePriceBuckets returns the price buckets given by the comma separated
+// edges or the width of a request, by default buckets are defaultBucketWidth
+// wide
+func parsePriceBuckets(vars url.Values, edgesParam, widthParam string) (priceBuckets, error) {
+	edges, width := vars.Get(edgesParam), vars.Get(widthParam)
+	switch {
+	case edges != "" && width != "":
+		return priceBuckets{}, fmt.Errorf("%s and %s are mutually exclusive", edgesParam, widthParam)
+	case edges != "":
+		var buckets priceBuckets
+		for _, field := range strings.Split(edges, ",") {
+			edge, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+			if err != nil || edge < 0 || math.IsInf(edge, 0) {
+				return buckets, fmt.Errorf("%s must be non-negative prices: %s", edgesParam, field)
+			}
+			buckets.edges = append(buckets.edges, float32(edge))
+		}
+		return buckets, buckets.validate(edgesParam)
+	case width != "":
+		bucketWidth, err := strconv.ParseFloat(width, 32)
+		if err != nil || !(bucketWidth > 0) || math.IsInf(bucketWidth, 0) {
+			return priceBuckets{}, fmt.Errorf("%s must be a positive price: %s", widthParam, width)
+		}
+		return priceBuckets{width: float32(bucketWidth)}, nil
+	}
+	return priceBuckets{width: defaultBucketWidth}, nil
+}
+
+// validate checks the edges are strictly ascending
+func (b priceBuckets) validate(param string) error {
+	if b.width > 0 {
+		return nil
+	}
+	if len(b.edges) == 0 || len(b.edges) >= maxPriceBuckets {
+		return fmt.Errorf("%s must hold between 1 and %d edges", param, maxPriceBuckets-1)
+	}
+	for i := 1; i < len(b.edges); i++ {
+		if b.edges[i] <= b.edges[i-1] {
+			return errors.New(param + " must be strictly ascending")
+		}
+	}
+	return nil
+}
+
+// index returns the bucket of a price. With edges bucket 0 holds the prices
+// below the first edge and bucket i those from edge i-1.
+func (b priceBuckets) index(price float32) int {
+	if b.width > 0 {
+		return int(math.Floor(float64(price / b.width)))
+	}
+	return sort.Search(len(b.edges), func(i int) bool {
+		return b.edges[i] > price
+	})
+}
+
+// bucket returns the bounds of bucket i
+func (b priceBuckets) bucket(i int) priceBucket {
+	if b.width > 0 {
+		max := float32(i+1) * b.width
+		return priceBucket{Min: float32(i) * b.width, Max: &max}
+	}
+	var bucket priceBucket
+	if i > 0 {
+		bucket.Min = b.edges[i-1]
+	}
+	if i < len(b.edges) {
+		max := b.edges[i]
+		bucket.Max = &max
+	}
+	return bucket
+}
+
+// priceCounter counts cars and vehicles per price bucket
+type priceCounter struct {
+	buckets  priceBuckets
+	cars     map[int]int
+	vehicles map[int]int
+	// overflow is a price beyond maxBucketIndex fixed width buckets from 0,
+	// if any
+	overflow *float32
+}
+
+func newPriceCounter(buckets priceBuckets) *priceCounter {
+	return &priceCounter{buckets: buckets, cars: make(map[int]int), vehicles: make(map[int]int)}
+}
+
+func (c *priceCounter) add(price float32, vehicles int) {
+	if c.buckets.width > 0 && math.Abs(float64(price)/float64(c.buckets.width)) >= maxBucketIndex {
+		c.overflow = &price
+		return
+	}
+	i := c.buckets.index(price)
+	c.cars[i]++
+	c.vehicles[i] += vehicles
+}
+
+// result returns the counted buckets in price order. Fixed width buckets
+// range from the cheapest to the most expensive bucket counted, edges
+// always give every bucket, but the one below an edge at 0.
+func (c *priceCounter) result() ([]priceBucket, error) {
+	if c.overflow != nil {
+		return nil, fmt.Errorf("price %g is more than %d buckets of width %g away from 0, overflowing the bucket index: use wider buckets", *c.overflow, maxBucketIndex, c.buckets.width)
+	}
+	first, last := 0, len(c.buckets.edges)
+	if c.buckets.width > 0 {
+		if len(c.cars) == 0 {
+			return []priceBucket{}, nil
+		}
+		first, last = math.MaxInt32, math.MinInt32
+		for i := range c.cars {
+			if i < first {
+				first = i
+			}
+			if i > last {
+				last = i
+			}
+		}
+	} else if c.buckets.edges[0] <= 0 {
+		first = 1
+	}
+	if last-first+1 > maxPriceBuckets {
+		return nil, fmt.Errorf("prices span %d buckets, more than %d: use wider buckets", last-first+1, maxPriceBuckets)
+	}
+
+	result := make([]priceBucket, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		bucket := c.buckets.bucket(i)
+		bucket.Cars = c.cars[i]
+		bucket.Vehicles = c.vehicles[i]
+		result = append(result, bucket)
+	}
+	return result, nil
+}
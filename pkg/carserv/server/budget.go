@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// budgetTolerance defines how far below and above the budget prices match,
+// as fractions of the budget
+type budgetTolerance struct {
+	under float64
+	over  float64
+}
+
+// defaultBudgetTolerance matches prices within 10% of the budget
+var defaultBudgetTolerance = budgetTolerance{under: 0.10, over: 0.10}
+
+// validTolerance reports whether a tolerance fraction is usable
+func validTolerance(fraction float64) bool {
+	return fraction >= 0 && fraction <= 1
+}
+
+// window returns the exclusive price bounds matching budget, the budget
+// itself always matches
+func (t budgetTolerance) window(budget float32) (float32, float32) {
+	below, above := budget*float32(1-t.under), budget*float32(1+t.over)
+	if below >= budget {
+		below = math.Nextafter32(budget, float32(math.Inf(-1)))
+	}
+	if above <= budget {
+		above = math.Nextafter32(budget, float32(math.Inf(1)))
+	}
+	return below, above
+}
+
+// budgetWindow returns the window applied to budget as reported in
+// responses
+func (t budgetTolerance) budgetWindow(budget float32) *dal.BudgetWindow {
+	return &dal.BudgetWindow{
+		Under: t.under,
+		Over:  t.over,
+		Min:   budget * float32(1-t.under),
+		Max:   budget * float32(1+t.over),
+	}
+}
+
+// validateBudgetTolerance returns the tolerance of a search, budget_tolerance
+// sets both sides of the defaults and budget_under and budget_over each side
+func validateBudgetTolerance(vars url.Values, defaults budgetTolerance) (budgetTolerance, error) {
+	tolerance := defaults
+	for _, param := range []struct {
+		name   string
+		fields []*float64
+	}{
+		{name: "budget_tolerance", fields: []*float64{&tolerance.under, &tolerance.over}},
+		{name: "budget_under", fields: []*float64{&tolerance.under}},
+		{name: "budget_over", fields: []*float64{&tolerance.over}},
+	} {
+		value := vars.Get(param.name)
+		if value == "" {
+			continue
+		}
+		fraction, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return tolerance, fmt.Errorf("%s: %v", param.name, err)
+		}
+		if !validTolerance(fraction) {
+			return tolerance, fmt.Errorf("%s must be between 0 and 1: %s", param.name, value)
+		}
+		for _, field := range param.fields {
+			*field = fraction
+		}
+	}
+	return tolerance, nil
+}
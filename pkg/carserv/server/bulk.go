@@ -0,0 +1,178 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+const (
+	// bulkBatchSize is the number of rows written to the store at once
+	bulkBatchSize = 500
+	// maxBulkResults limits the rows reported one by one in a response,
+	// the summary counts every row
+	maxBulkResults = 1000
+)
+
+const (
+	bulkCreated  = "created"
+	bulkUpdated  = "updated"
+	bulkRejected = "rejected"
+)
+
+// bulkResult defines the outcome of a single row of a bulk request
+type bulkResult struct {
+	Line   int    `json:"line"`
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// bulkSummary defines the totals of a bulk request
+type bulkSummary struct {
+	Created  int `json:"created"`
+	Updated  int `json:"updated"`
+	Rejected int `json:"rejected"`
+	// Truncated tells results stop after maxBulkResults rows
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// bulkReport defines the outcome of each row of a bulk request along with
+// its totals
+type bulkReport struct {
+	Results []bulkResult `json:"results"`
+	Summary bulkSummary  `json:"summary"`
+}
+
+// BulkCars defines a POST handler to upsert a stream of NDJSON or CSV rows.
+// Rows are written in batches as they are read and the report, as
+// {"results": [...], "summary": {...}}, is written once the whole body has
+// been read, so that the body stays readable and Expect: 100-continue
+// requests are answered. Only the first maxBulkResults rows are reported
+// one by one. The rows read before an unreadable body are still
+// written, the error being reported in the summary.
+func (h *httpServer) BulkCars(w http.ResponseWriter, r *http.Request) {
+	format, err := bulkFormat(r)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+
+	dec, err := dal.NewDecoder(r.Body, format)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+
+	report := bulkReport{Results: []bulkResult{}}
+	var pending []bulkResult
+	var batch []dal.Car
+	flush := func() {
+		results := h.store.Upsert(batch)
+		for i := range pending {
+			if pending[i].Status == bulkRejected {
+				continue
+			}
+			result := results[0]
+			results = results[1:]
+			switch {
+			case result.Err != nil:
+				pending[i].Status = bulkRejected
+				pending[i].Reason = result.Err.Error()
+			case result.Created:
+				pending[i].ID = result.Car.ID
+				pending[i].Status = bulkCreated
+			default:
+				pending[i].ID = result.Car.ID
+				pending[i].Status = bulkUpdated
+			}
+		}
+		for _, result := range pending {
+			report.Summary.add(result.Status)
+			if len(report.Results) == maxBulkResults {
+				report.Summary.Truncated = true
+				continue
+			}
+			report.Results = append(report.Results, result)
+		}
+		pending = pending[:0]
+		batch = batch[:0]
+	}
+
+	for {
+		car, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *dal.RowError
+		if errors.As(err, &rowErr) {
+			pending = append(pending, bulkResult{Line: rowErr.Line, Status: bulkRejected, Reason: rowReason(rowErr)})
+			if len(pending) == bulkBatchSize {
+				flush()
+			}
+			continue
+		}
+		if err != nil {
+			h.log.Printf("bulk request aborted: %v", err)
+			report.Summary.Error = err.Error()
+			break
+		}
+
+		pending = append(pending, bulkResult{Line: dec.Line()})
+		batch = append(batch, car)
+		if len(pending) == bulkBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	writeJSON(w, http.StatusOK, report)
+	h.log.Printf("bulk request: %d created, %d updated, %d rejected", report.Summary.Created, report.Summary.Updated, report.Summary.Rejected)
+}
+
+// rowReason returns why a row was rejected, without the line already
+// reported along with it
+func rowReason(rowErr *dal.RowError) string {
+	if rowErr.Field == "" {
+		return rowErr.Err.Error()
+	}
+	return fmt.Sprintf("field %s: %v", rowErr.Field, rowErr.Err)
+}
+
+func (s *bulkSummary) add(status string) {
+	switch status {
+	case bulkCreated:
+		s.Created++
+	case bulkUpdated:
+		s.Updated++
+	case bulkRejected:
+		s.Rejected++
+	}
+}
+
+// bulkFormat returns the dataset format of a bulk request, given by the
+// format query parameter or the Content-Type header
+func bulkFormat(r *http.Request) (dal.Format, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return dal.ParseFormat(format)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", fmt.Errorf("invalid Content-Type: %v", err)
+	}
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return dal.FormatNDJSON, nil
+	case "text/csv":
+		return dal.FormatCSV, nil
+	case "application/json":
+		return dal.FormatJSON, nil
+	}
+	return "", fmt.Errorf("unsupported Content-Type: %s", mediaType)
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// maxCarBodySize limits the size of a single car request body
+const maxCarBodySize = 1 << 20
+
+// carRecord defines the representation of a car in the inventory API
+type carRecord struct {
+	ID           int     `json:"id"`
+	Version      int     `json:"version"`
+	Make         string  `json:"make"`
+	Model        string  `json:"model"`
+	Year         int     `json:"year"`
+	VehicleCount int     `json:"vehicle_count"`
+	Price        float32 `json:"price"`
+}
+
+// carPatch defines a partial update of a car, nil fields are left unchanged
+type carPatch struct {
+	Make         *string  `json:"make"`
+	Model        *string  `json:"model"`
+	Year         *int     `json:"year"`
+	VehicleCount *int     `json:"vehicle_count"`
+	Price        *float32 `json:"price"`
+}
+
+func newCarRecord(car dal.Car) carRecord {
+	return carRecord{
+		ID:           car.ID,
+		Version:      car.Version,
+		Make:         car.Make,
+		Model:        car.Model,
+		Year:         car.Year,
+		VehicleCount: car.VehicleCount,
+		Price:        car.Price,
+	}
+}
+
+func (c carRecord) car() dal.Car {
+	return dal.Car{
+		ID:           c.ID,
+		Make:         c.Make,
+		Model:        c.Model,
+		Year:         c.Year,
+		VehicleCount: c.VehicleCount,
+		Price:        c.Price,
+	}
+}
+
+func (p carPatch) apply(car dal.Car) dal.Car {
+	if p.Make != nil {
+		car.Make = *p.Make
+	}
+	if p.Model != nil {
+		car.Model = *p.Model
+	}
+	if p.Year != nil {
+		car.Year = *p.Year
+	}
+	if p.VehicleCount != nil {
+		car.VehicleCount = *p.VehicleCount
+	}
+	if p.Price != nil {
+		car.Price = *p.Price
+	}
+	return car
+}
+
+// CreateCar defines a POST handler to add a car to the inventory
+func (h *httpServer) CreateCar(w http.ResponseWriter, r *http.Request) {
+	var record carRecord
+	if err := decodeBody(w, r, &record); err != nil {
+		h.log.Printf("car decoding failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if record.ID != 0 || record.Version != 0 {
+		writeError(w, http.StatusBadRequest, errors.New("id and version are assigned by the server"))
+		return
+	}
+
+	car, err := h.store.Create(record.car())
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/cars/%d", car.ID))
+	w.Header().Set("ETag", etag(car))
+	writeJSON(w, http.StatusCreated, newCarRecord(car))
+}
+
+// GetCar defines a GET handler to fetch a single car
+func (h *httpServer) GetCar(w http.ResponseWriter, r *http.Request) {
+	id, err := carID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	car, err := h.store.Get(id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(car))
+	writeJSON(w, http.StatusOK, newCarRecord(car))
+}
+
+// ReplaceCar defines a PUT handler to replace a car
+func (h *httpServer) ReplaceCar(w http.ResponseWriter, r *http.Request) {
+	id, err := carID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ifMatch, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, http.StatusPreconditionRequired, err)
+		return
+	}
+
+	var record carRecord
+	if err := decodeBody(w, r, &record); err != nil {
+		h.log.Printf("car decoding failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if record.ID != 0 && record.ID != id {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("id %d does not match the path id %d", record.ID, id))
+		return
+	}
+
+	car, err := h.store.Update(id, func(current dal.Car) (dal.Car, error) {
+		if err := checkIfMatch(ifMatch, current); err != nil {
+			return dal.Car{}, err
+		}
+		return record.car(), nil
+	})
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(car))
+	writeJSON(w, http.StatusOK, newCarRecord(car))
+}
+
+// PatchCar defines a PATCH handler to update some fields of a car
+func (h *httpServer) PatchCar(w http.ResponseWriter, r *http.Request) {
+	id, err := carID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ifMatch, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, http.StatusPreconditionRequired, err)
+		return
+	}
+
+	var patch carPatch
+	if err := decodeBody(w, r, &patch); err != nil {
+		h.log.Printf("car patch decoding failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	car, err := h.store.Update(id, func(current dal.Car) (dal.Car, error) {
+		if err := checkIfMatch(ifMatch, current); err != nil {
+			return dal.Car{}, err
+		}
+		return patch.apply(current), nil
+	})
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(car))
+	writeJSON(w, http.StatusOK, newCarRecord(car))
+}
+
+// DeleteCar defines a DELETE handler to remove a car
+func (h *httpServer) DeleteCar(w http.ResponseWriter, r *http.Request) {
+	id, err := carID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ifMatch, err := requireIfMatch(r)
+	if err != nil {
+		writeError(w, http.StatusPreconditionRequired, err)
+		return
+	}
+
+	err = h.store.Delete(id, func(current dal.Car) error {
+		return checkIfMatch(ifMatch, current)
+	})
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeStoreError maps store errors onto HTTP status codes
+func (h *httpServer) writeStoreError(w http.ResponseWriter, err error) {
+	var fieldErr *dal.FieldError
+	switch {
+	case errors.Is(err, dal.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, dal.ErrDuplicateID):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, dal.ErrVersionConflict):
+		writeError(w, http.StatusPreconditionFailed, err)
+	case errors.As(err, &fieldErr):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		h.log.Printf("store operation failed: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// etag returns the entity tag of a car, which changes with every write
+func etag(car dal.Car) string {
+	return fmt.Sprintf(`"%d"`, car.Version)
+}
+
+// requireIfMatch returns the entity tags of the If-Match header, writes to a
+// car must name the version they were based on
+func requireIfMatch(r *http.Request) ([]string, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil, errors.New("If-Match header is required")
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// checkIfMatch returns dal.ErrVersionConflict unless one of the tags matches
+// the current version of the car
+func checkIfMatch(tags []string, current dal.Car) error {
+	currentTag := etag(current)
+	for _, tag := range tags {
+		if tag == "*" || tag == currentTag {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: car %d is at version %d", dal.ErrVersionConflict, current.ID, current.Version)
+}
+
+func carID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid car id: %s", mux.Vars(r)["id"])
+	}
+	return id, nil
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCarBodySize))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
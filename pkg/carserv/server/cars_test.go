@@ -0,0 +1,341 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+func TestCarsCRUD(t *testing.T) {
+	ts, store := newTestServer(t, testCars[:1])
+
+	// Steps run in order and share the store, an ifMatch of "last" sends
+	// the ETag of the previous step
+	lastETag := ""
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		ifMatch    string
+		body       string
+		statusCode int
+		expected   carRecord
+	}{
+		{
+			name:       "Create",
+			method:     http.MethodPost,
+			path:       "/cars",
+			body:       `{"make": "Honda", "model": "Civic", "year": 2019, "vehicle_count": 7, "price": 21000}`,
+			statusCode: http.StatusCreated,
+			expected:   carRecord{ID: 2, Version: 2, Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+		},
+		{
+			name:       "CreateInvalid",
+			method:     http.MethodPost,
+			path:       "/cars",
+			body:       `{"make": "Honda", "model": "", "year": 2019, "vehicle_count": 7, "price": 21000}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "CreateUnknownField",
+			method:     http.MethodPost,
+			path:       "/cars",
+			body:       `{"make": "Honda", "model": "Civic", "colour": "red"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Get",
+			method:     http.MethodGet,
+			path:       "/cars/2",
+			statusCode: http.StatusOK,
+			expected:   carRecord{ID: 2, Version: 2, Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+		},
+		{
+			name:       "PatchWithoutIfMatch",
+			method:     http.MethodPatch,
+			path:       "/cars/2",
+			body:       `{"price": 19500}`,
+			statusCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:       "Patch",
+			method:     http.MethodPatch,
+			path:       "/cars/2",
+			ifMatch:    `"2"`,
+			body:       `{"price": 19500}`,
+			statusCode: http.StatusOK,
+			expected:   carRecord{ID: 2, Version: 3, Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 19500},
+		},
+		{
+			name:       "PatchInvalid",
+			method:     http.MethodPatch,
+			path:       "/cars/2",
+			ifMatch:    "*",
+			body:       `{"year": -1}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "ReplaceStale",
+			method:     http.MethodPut,
+			path:       "/cars/2",
+			ifMatch:    `"2"`,
+			body:       `{"make": "Honda", "model": "Accord", "year": 2020, "vehicle_count": 3, "price": 26000}`,
+			statusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Replace",
+			method:     http.MethodPut,
+			path:       "/cars/2",
+			ifMatch:    `"3"`,
+			body:       `{"make": "Honda", "model": "Accord", "year": 2020, "vehicle_count": 3, "price": 26000}`,
+			statusCode: http.StatusOK,
+			expected:   carRecord{ID: 2, Version: 4, Make: "Honda", Model: "Accord", Year: 2020, VehicleCount: 3, Price: 26000},
+		},
+		{
+			name:       "DeleteStale",
+			method:     http.MethodDelete,
+			path:       "/cars/2",
+			ifMatch:    `"3"`,
+			statusCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "Delete",
+			method:     http.MethodDelete,
+			path:       "/cars/2",
+			ifMatch:    "last",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "GetDeleted",
+			method:     http.MethodGet,
+			path:       "/cars/2",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.ifMatch == "last" {
+				req.Header.Set("If-Match", lastETag)
+			} else if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if tc.expected.ID == 0 {
+				return
+			}
+			lastETag = resp.Header.Get("ETag")
+
+			var record carRecord
+			if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+				t.Fatal(err)
+			}
+			if record != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, record)
+			}
+		})
+	}
+
+	if store.Count() != 1 {
+		t.Errorf("Expected 1 car left in the store, Got: %d", store.Count())
+	}
+}
+
+func TestBulkCars(t *testing.T) {
+	ts, store := newTestServer(t, []dal.Car{testCars[0], testCars[2]})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		results     []bulkResult
+		summary     bulkSummary
+	}{
+		{
+			name:        "NDJSON",
+			contentType: "application/x-ndjson",
+			body: `{"make": "Ford", "model": "F-150", "year": 2019, "vehicle_count": 12, "price": 29500}
+{"make": "Ford", "model": "Van", "year": 2021}
+{"make": "Kia", "model": "Soul", "year": 2020, "vehicle_count": 3, "price": 18000}
+{"id": 2, "make": "Honda", "model": "Civic", "year": 2019, "vehicle_count": 5, "price": 20000}
+`,
+			results: []bulkResult{
+				{Line: 1, ID: 1, Status: bulkUpdated},
+				{Line: 2, Status: bulkRejected, Reason: `field vehicle_count: strconv.Atoi: parsing "": invalid syntax`},
+				{Line: 3, ID: 3, Status: bulkCreated},
+				{Line: 4, ID: 2, Status: bulkUpdated},
+			},
+			summary: bulkSummary{Created: 1, Updated: 2, Rejected: 1},
+		},
+		{
+			name:        "CSV",
+			contentType: "text/csv",
+			body:        "make,model,year,vehicle_count,price\nKia,Soul,2020,4,17500\nKia,Rio,2020,-1,15000\n",
+			results: []bulkResult{
+				{Line: 2, ID: 3, Status: bulkUpdated},
+				{Line: 3, Status: bulkRejected, Reason: "field vehicle_count: must not be negative: -1"},
+			},
+			summary: bulkSummary{Updated: 1, Rejected: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/cars:bulk", tc.contentType, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var report bulkReport
+			if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(report.Results, tc.results) {
+				t.Errorf("Expected: %v, Got: %v", tc.results, report.Results)
+			}
+			if report.Summary != tc.summary {
+				t.Errorf("Expected: %v, Got: %v", tc.summary, report.Summary)
+			}
+		})
+	}
+
+	if car, _ := store.Get(3); car.VehicleCount != 4 || car.Price != 17500 {
+		t.Errorf("Expected the bulk update to be stored, Got: %v", car)
+	}
+}
+
+func TestBulkCarsStreamed(t *testing.T) {
+	ts, store := newTestServer(t, nil)
+
+	// The body is streamed in chunks spanning several batches
+	const rows = 3*bulkBatchSize + 42
+	body, feed := io.Pipe()
+	go func() {
+		for i := 0; i < rows; i++ {
+			fmt.Fprintf(feed, `{"make": "Make %d", "model": "Model", "year": 2020, "vehicle_count": 1, "price": 10000}`+"\n", i)
+		}
+		feed.Close()
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/cars:bulk", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Expect", "100-continue")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var report bulkReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (bulkSummary{Created: rows, Truncated: true}); report.Summary != expected {
+		t.Errorf("Expected: %v, Got: %v", expected, report.Summary)
+	}
+	if len(report.Results) != maxBulkResults || store.Count() != rows {
+		t.Errorf("Expected %d results and %d cars, Got: %d results and %d cars", maxBulkResults, rows, len(report.Results), store.Count())
+	}
+}
+
+func TestGetSimilarCars(t *testing.T) {
+	ts, _ := newTestServer(t, testCars)
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		expected   []int
+	}{
+		{
+			name:       "Nearest",
+			path:       "/cars/3/similar?limit=2",
+			statusCode: http.StatusOK,
+			expected:   []int{5, 1},
+		},
+		{
+			name:       "ExcludeSameMake",
+			path:       "/cars/1/similar?exclude_same_make=true",
+			statusCode: http.StatusOK,
+			expected:   []int{3, 5},
+		},
+		{
+			name:       "AffinityOnly",
+			path:       "/cars/1/similar?weight_price=0&weight_year=0&weight_vehicles=0",
+			statusCode: http.StatusOK,
+			expected:   []int{2, 4, 3, 5},
+		},
+		{
+			name:       "NotFound",
+			path:       "/cars/99/similar",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "NegativeWeight",
+			path:       "/cars/1/similar?weight_price=-1",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "InvalidExcludeSameMake",
+			path:       "/cars/1/similar?exclude_same_make=maybe",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var result similarCars
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for k, car := range result.Similar {
+				ids = append(ids, car.ID)
+				if k > 0 && car.Distance < result.Similar[k-1].Distance {
+					t.Errorf("Expected cars nearest first, Got: %+v", result.Similar)
+				}
+			}
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, ids)
+			}
+		})
+	}
+}
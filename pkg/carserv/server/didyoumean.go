@@ -0,0 +1,160 @@
+package server
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// didYouMean returns the alternatives to a search matching no car, nil when
+// there is none. Filters are relaxed one at a time, the cars matching every
+// other filter and the query, and the nearest budget is looked up among the
+// cars matching every other filter.
+func didYouMean(snap *dal.Snapshot, params searchParams) *dal.DidYouMean {
+	params = params.resolve(snap)
+	car := params.car
+	var result dal.DidYouMean
+
+	// Terms matching no car may be misspelt
+	if car.Make != "" && len(params.makePositions(snap)) == 0 {
+		result.Make = snap.Index.ResolveMake(car.Make)
+	}
+	if car.Model != "" && len(params.modelPositions(snap)) == 0 {
+		result.Model = snap.Index.ResolveModel(car.Model)
+	}
+
+	// without returns params matching every filter but the one dropped
+	without := func(drop func(car *dal.Car)) searchParams {
+		relaxed := params
+		relaxed.match = matchAll
+		drop(&relaxed.car)
+		return relaxed
+	}
+	filters := []struct {
+		name  string
+		given bool
+		drop  func(car *dal.Car)
+		add   func(relaxation *dal.Relaxation, car dal.Car)
+	}{
+		{
+			name:  "make",
+			given: car.Make != "",
+			drop:  func(car *dal.Car) { car.Make = "" },
+			add: func(relaxation *dal.Relaxation, car dal.Car) {
+				relaxation.Makes = appendDistinct(relaxation.Makes, car.Make)
+			},
+		},
+		{
+			name:  "model",
+			given: car.Model != "",
+			drop:  func(car *dal.Car) { car.Model = "" },
+			add: func(relaxation *dal.Relaxation, car dal.Car) {
+				relaxation.Models = appendDistinct(relaxation.Models, car.Model)
+			},
+		},
+		{
+			name:  "year",
+			given: car.Year > 0,
+			drop:  func(car *dal.Car) { car.Year = 0 },
+			add: func(relaxation *dal.Relaxation, car dal.Car) {
+				for _, year := range relaxation.Years {
+					if year == car.Year {
+						return
+					}
+				}
+				relaxation.Years = append(relaxation.Years, car.Year)
+			},
+		},
+		{
+			name:  "budget",
+			given: car.Price > 0.0,
+			drop:  func(car *dal.Car) { car.Price = 0 },
+			add:   func(relaxation *dal.Relaxation, car dal.Car) {},
+		},
+	}
+
+	var given int
+	for _, filter := range filters {
+		if filter.given {
+			given++
+		}
+	}
+	// Dropping the only filter would match every car
+	for _, filter := range filters {
+		if !filter.given || given < 2 {
+			continue
+		}
+		relaxation := dal.Relaxation{Without: filter.name}
+		for _, i := range matching(snap, without(filter.drop)) {
+			relaxation.Vehicles += snap.Cars[i].VehicleCount
+			filter.add(&relaxation, snap.Cars[i])
+		}
+		if relaxation.Vehicles > 0 {
+			sort.Strings(relaxation.Makes)
+			sort.Strings(relaxation.Models)
+			sort.Ints(relaxation.Years)
+			result.Relaxed = append(result.Relaxed, relaxation)
+		}
+	}
+
+	if car.Price > 0.0 {
+		result.Budget = nearestBudget(snap, without(func(car *dal.Car) { car.Price = 0 }), car.Price)
+	}
+
+	if result.Make == nil && result.Model == nil && result.Relaxed == nil && result.Budget == nil {
+		return nil
+	}
+	return &result
+}
+
+// emptyFilter tells whether a filter of the resolved params matches no car
+// on its own
+func emptyFilter(snap *dal.Snapshot, params searchParams) bool {
+	car := params.car
+	switch {
+	case car.Make != "" && len(params.makePositions(snap)) == 0,
+		car.Model != "" && len(params.modelPositions(snap)) == 0,
+		car.Year > 0 && len(snap.Index.Year(car.Year)) == 0,
+		car.Price > 0.0 && len(snap.Index.PriceRange(params.tolerance.window(car.Price))) == 0,
+		params.query != nil && len(params.query.Positions(snap)) == 0:
+		return true
+	}
+	return false
+}
+
+// nearestBudget returns the budget closest to budget matching cars along
+// with the filters of params, nil when they match no vehicle. A car priced
+// at the budget always matches it.
+func nearestBudget(snap *dal.Snapshot, params searchParams, budget float32) *dal.NearestBudget {
+	positions := matching(snap, params)
+	nearest := float32(-1)
+	for _, i := range positions {
+		price := snap.Cars[i].Price
+		if snap.Cars[i].VehicleCount == 0 || price <= 0.0 {
+			continue
+		}
+		d, best := math.Abs(float64(price-budget)), math.Abs(float64(nearest-budget))
+		if nearest < 0 || d < best || d == best && price < nearest {
+			nearest = price
+		}
+	}
+	if nearest < 0 {
+		return nil
+	}
+
+	result := &dal.NearestBudget{Budget: nearest, Window: *params.tolerance.budgetWindow(nearest)}
+	for _, i := range positions {
+		if budgetMatch(snap.Cars[i], nearest, params.tolerance) {
+			result.Vehicles += snap.Cars[i].VehicleCount
+		}
+	}
+	return result
+}
+
+func appendDistinct(values []string, value string) []string {
+	if contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
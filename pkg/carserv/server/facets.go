@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+)
+
+// facetCount defines the number of vehicles holding a value of a field
+type facetCount struct {
+	Value    string `json:"value"`
+	Vehicles int    `json:"vehicles"`
+}
+
+// yearCount defines the number of vehicles of a year
+type yearCount struct {
+	Value    int `json:"value"`
+	Vehicles int `json:"vehicles"`
+}
+
+// facets defines the vehicle counts per value of each field among the cars
+// matching a search
+type facets struct {
+	Vehicles int           `json:"vehicles"`
+	Make     []facetCount  `json:"make"`
+	Model    []facetCount  `json:"model"`
+	Year     []yearCount   `json:"year"`
+	Price    []priceBucket `json:"price"`
+}
+
+// GetFacets defines a GET handler counting the vehicles per make, model,
+// year and price bucket among the cars matching the search filters
+func (h *httpServer) GetFacets(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	params, err := h.parseSearch(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.match == "" {
+		params.match = matchAll
+	}
+
+	buckets, err := parsePriceBuckets(vars, "price_buckets", "price_bucket_width")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	snap := h.store.Snapshot()
+	makes := make(map[string]int)
+	models := make(map[string]int)
+	years := make(map[int]int)
+	prices := newPriceCounter(buckets)
+
+	done := ctx.Done()
+	var result facets
+	for _, i := range matching(snap, params) {
+		if cancelled(done) {
+			h.writeProcessorError(w, r, ctx.Err())
+			return
+		}
+		car := snap.Cars[i]
+		result.Vehicles += car.VehicleCount
+		makes[car.Make] += car.VehicleCount
+		models[car.Model] += car.VehicleCount
+		years[car.Year] += car.VehicleCount
+		prices.add(car.Price, car.VehicleCount)
+	}
+	if err := ctx.Err(); err != nil {
+		h.writeProcessorError(w, r, err)
+		return
+	}
+
+	result.Price, err = prices.result()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result.Make = facetCounts(makes)
+	result.Model = facetCounts(models)
+
+	// Years are listed in order rather than by count
+	result.Year = make([]yearCount, 0, len(years))
+	for year, vehicles := range years {
+		result.Year = append(result.Year, yearCount{Value: year, Vehicles: vehicles})
+	}
+	sort.Slice(result.Year, func(a, b int) bool {
+		return result.Year[a].Value < result.Year[b].Value
+	})
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// facetCounts returns the counts of a field, most vehicles first
+func facetCounts(counts map[string]int) []facetCount {
+	result := make([]facetCount, 0, len(counts))
+	for value, vehicles := range counts {
+		result = append(result, facetCount{Value: value, Vehicles: vehicles})
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Vehicles != result[b].Vehicles {
+			return result[a].Vehicles > result[b].Vehicles
+		}
+		return result[a].Value < result[b].Value
+	})
+	return result
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// validateFuzzy parses the fuzzy parameter, false when not given
+func validateFuzzy(vars url.Values) (bool, error) {
+	value := vars.Get("fuzzy")
+	if value == "" {
+		return false, nil
+	}
+	fuzzy, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("fuzzy must be true or false: %s", value)
+	}
+	return fuzzy, nil
+}
+
+// resolve returns params with the makes and models its fuzzy make and model
+// terms resolve to in snap
+func (p searchParams) resolve(snap *dal.Snapshot) searchParams {
+	if !p.fuzzy || p.makes != nil || p.models != nil {
+		return p
+	}
+	if p.car.Make != "" {
+		p.makes = append([]string{}, snap.Index.ResolveMake(p.car.Make)...)
+	}
+	if p.car.Model != "" {
+		p.models = append([]string{}, snap.Index.ResolveModel(p.car.Model)...)
+	}
+	return p
+}
+
+// resolved returns the makes and models the fuzzy terms of params resolved
+// to, by filter, nil without fuzzy matching
+func (p searchParams) resolved() map[string][]string {
+	if !p.fuzzy || p.car.Make == "" && p.car.Model == "" {
+		return nil
+	}
+	resolved := make(map[string][]string)
+	if p.car.Make != "" {
+		resolved["make"] = p.makes
+	}
+	if p.car.Model != "" {
+		resolved["model"] = p.models
+	}
+	return resolved
+}
+
+// makePositions returns the sorted positions of the cars matching the make
+// filter
+func (p searchParams) makePositions(snap *dal.Snapshot) []int {
+	if p.fuzzy {
+		return snap.Index.MakeIn(p.makes)
+	}
+	return snap.Index.MakeContains(p.car.Make)
+}
+
+// modelPositions returns the sorted positions of the cars matching the model
+// filter
+func (p searchParams) modelPositions(snap *dal.Snapshot) []int {
+	if p.fuzzy {
+		return snap.Index.ModelIn(p.models)
+	}
+	return snap.Index.ModelContains(p.car.Model)
+}
+
+func (p searchParams) matchMake(car dal.Car) bool {
+	if p.fuzzy {
+		return contains(p.makes, car.Make)
+	}
+	return makeMatch(car, p.car.Make)
+}
+
+func (p searchParams) matchModel(car dal.Car) bool {
+	if p.fuzzy {
+		return contains(p.models, car.Model)
+	}
+	return modelMatch(car, p.car.Model)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
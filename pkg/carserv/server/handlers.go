@@ -1,15 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/query"
 )
 
 // GetCars defines a GET handler to fetch cars from dataset
@@ -17,39 +20,35 @@ func (h *httpServer) GetCars(w http.ResponseWriter, r *http.Request) {
 	vars := r.URL.Query()
 	w.Header().Add("Content-Type", "application/json")
 
-	modelName, err := validateModelName(w, vars)
+	params, err := h.parseSearch(vars)
 	if err != nil {
-		h.log.Printf("model name validation failed: %v", err)
+		h.log.Printf("search validation failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	makeName, err := validateMakeName(w, vars)
+	params.rank, err = parseRank(vars, h.rankWeights)
 	if err != nil {
-		h.log.Printf("make name validation failed: %v", err)
+		h.log.Printf("rank validation failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-
-	budget, err := validateBudget(w, vars)
+	params.limit, err = parseLimit(vars, defaultSuggestions, maxSuggestions)
 	if err != nil {
-		h.log.Printf("budget validation failed: %v", err)
+		h.log.Printf("limit validation failed: %v", err)
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	year, err := validateYear(w, vars)
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	cars, err := processor(ctx, h.store.Snapshot(), params)
 	if err != nil {
-		h.log.Printf("year validation failed: %v", err)
+		h.writeProcessorError(w, r, err)
 		return
 	}
 
-	car := dal.Car{
-		Make:  makeName,
-		Model: modelName,
-		Price: budget,
-		Year:  year,
-	}
-
-	cars := processor(car)
-
 	err = json.NewEncoder(w).Encode(cars)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -59,46 +58,216 @@ func (h *httpServer) GetCars(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func validateYear(w http.ResponseWriter, vars url.Values) (int, error) {
+// parseSearch returns the filters shared by the search endpoints, an error
+// when they are invalid
+func (h *httpServer) parseSearch(vars url.Values) (searchParams, error) {
+	modelName, err := validateModelName(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	makeName, err := validateMakeName(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	budget, err := validateBudget(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	year, err := validateYear(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	expr, err := validateQuery(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+	// make: and model: terms are aliased like the make and model filters
+	expr = query.MapText(expr, func(field, text string) string {
+		if field == query.FieldMake {
+			return h.aliases.Canonical(dal.AliasMakes, text)
+		}
+		return h.aliases.Canonical(dal.AliasModels, text)
+	})
+
+	ranges, err := validateRanges(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	match, err := validateMatch(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	tolerance, err := validateBudgetTolerance(vars, h.budgetTolerance)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	stats, err := validateStats(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	fuzzy, err := validateFuzzy(vars)
+	if err != nil {
+		return searchParams{}, err
+	}
+
+	return searchParams{
+		car: dal.Car{
+			Make:  h.aliases.Canonical(dal.AliasMakes, makeName),
+			Model: h.aliases.Canonical(dal.AliasModels, modelName),
+			Price: budget,
+			Year:  year,
+		},
+		query:     query.And(expr, ranges),
+		match:     match,
+		tolerance: tolerance,
+		stats:     stats,
+		fuzzy:     fuzzy,
+	}, nil
+
+}
+
+// searchContext returns the context of a search request, bounded by the
+// request timeout
+func (h *httpServer) searchContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.requestTimeout > 0 {
+		return context.WithTimeout(r.Context(), h.requestTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// writeProcessorError reports a search stopped before completion, 504 when
+// it ran out of time and 503 when it was cancelled
+func (h *httpServer) writeProcessorError(w http.ResponseWriter, r *http.Request, err error) {
+	h.log.Printf("search %s stopped: %v", r.URL.RawQuery, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, fmt.Errorf("search exceeded the %v request budget", h.requestTimeout))
+		return
+	}
+	writeError(w, http.StatusServiceUnavailable, fmt.Errorf("search cancelled: %v", err))
+}
+
+func validateYear(vars url.Values) (int, error) {
 	year := vars.Get("year")
 	if year != "" {
 		yearInt, err := strconv.Atoi(year)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
 			return 0, err
 		}
 		if yearInt < 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(fmt.Sprintf("year must be a positive number: %d", yearInt)))
-			return 0, errors.New("year must be a positive number")
+			return 0, fmt.Errorf("year must be a positive number: %d", yearInt)
 		}
 		return yearInt, nil
 	}
 	return 0, nil
 }
 
-func validateBudget(w http.ResponseWriter, vars url.Values) (float32, error) {
+func validateBudget(vars url.Values) (float32, error) {
 	budget := vars.Get("budget")
 	if budget != "" {
 		budgetDecimal, err := strconv.ParseFloat(budget, 32)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
 			return 0.0, err
 		}
 		if budgetDecimal < 0.0 {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(fmt.Sprintf("budget must be a positive number: %v", budgetDecimal)))
-			return 0.0, errors.New("budget must be a positive number")
-
+			return 0.0, fmt.Errorf("budget must be a positive number: %v", budgetDecimal)
 		}
 		return float32(budgetDecimal), nil
 	}
 	return 0.0, nil
 }
 
-func validateMakeName(w http.ResponseWriter, vars url.Values) (string, error) {
+// validateQuery parses the q parameter, nil when no query is given
+func validateQuery(vars url.Values) (query.Expr, error) {
+	q := vars.Get("q")
+	if q != "" {
+		expr, err := query.Parse(q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid q at %w", err)
+		}
+		return expr, nil
+	}
+	return nil, nil
+}
+
+// Bounds of the year and price range filters
+const (
+	minYear  = 1886
+	maxYear  = 9999
+	maxPrice = 1e9
+)
+
+// validateRanges parses the year_min, year_max, price_min and price_max
+// parameters into a query matching the cars within every range given, nil
+// when no range is given
+func validateRanges(vars url.Values) (query.Expr, error) {
+	var terms []query.Expr
+	var err error
+	badRequest := func(format string, a ...interface{}) (query.Expr, error) {
+		err = fmt.Errorf(format, a...)
+		return nil, err
+	}
+
+	bound := func(name, field, op string, parse func(string) (float32, error), low, high float32) (float32, bool) {
+		value := vars.Get(name)
+		if value == "" || err != nil {
+			return 0, false
+		}
+		number, parseErr := parse(value)
+		if parseErr != nil {
+			badRequest("%s: %v", name, parseErr)
+			return 0, false
+		}
+		if !(number >= low && number <= high) {
+			badRequest("%s must be between %v and %v: %v", name, low, high, value)
+			return 0, false
+		}
+		terms = append(terms, query.Compare(field, op, number))
+		return number, true
+	}
+	parseYear := func(value string) (float32, error) {
+		year, err := strconv.Atoi(value)
+		return float32(year), err
+	}
+	parsePrice := func(value string) (float32, error) {
+		price, err := strconv.ParseFloat(value, 32)
+		return float32(price), err
+	}
+
+	yearMin, hasYearMin := bound("year_min", query.FieldYear, ">=", parseYear, minYear, maxYear)
+	yearMax, hasYearMax := bound("year_max", query.FieldYear, "<=", parseYear, minYear, maxYear)
+	priceMin, hasPriceMin := bound("price_min", query.FieldPrice, ">=", parsePrice, 0, maxPrice)
+	priceMax, hasPriceMax := bound("price_max", query.FieldPrice, "<=", parsePrice, 0, maxPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasYearMin && hasYearMax && yearMin > yearMax {
+		return badRequest("year_min must not be greater than year_max: %v > %v", yearMin, yearMax)
+	}
+	if hasPriceMin && hasPriceMax && priceMin > priceMax {
+		return badRequest("price_min must not be greater than price_max: %v > %v", priceMin, priceMax)
+	}
+	return query.And(terms...), nil
+}
+
+func validateMatch(vars url.Values) (string, error) {
+	match := vars.Get("match")
+	switch match {
+	case "", matchAny, matchAll:
+		return match, nil
+	}
+	return "", fmt.Errorf("match must be %s or %s: %s", matchAny, matchAll, match)
+}
+
+func validateMakeName(vars url.Values) (string, error) {
 	makeName := vars.Get("make")
 	if makeName != "" {
 		// TODO: Add better validation for non alphanumeric values
@@ -107,7 +276,7 @@ func validateMakeName(w http.ResponseWriter, vars url.Values) (string, error) {
 	return "", nil
 }
 
-func validateModelName(w http.ResponseWriter, vars url.Values) (string, error) {
+func validateModelName(vars url.Values) (string, error) {
 	modelName := vars.Get("model")
 	if modelName != "" {
 		// TODO: Add better validation for non alphanumeric values
@@ -116,10 +285,59 @@ func validateModelName(w http.ResponseWriter, vars url.Values) (string, error) {
 	return "", nil
 }
 
-func processor(car dal.Car) dal.CarResponse {
-	// TODO: Add timeouts at the top to timeout if the requests takes too long to process
+// Match modes of a search
+const (
+	// matchAny matches the cars matching any of the filters
+	matchAny = "any"
+	// matchAll matches the cars matching every filter
+	matchAll = "all"
+)
+
+// searchParams defines the parameters of a search. car holds the make,
+// model, budget and year filters and a non nil query narrows every part of
+// the response to the cars it matches.
+//
+// Without a match mode the total counts the cars matching any filter while
+// the price stats and suggestions only consider the budget. With a match
+// mode all three cover the cars matched under that mode, every car when no
+// filter is given. tolerance sets the prices matching the budget.
+//
+// The weighted stats mode adds price stats weighted by vehicle counts and
+// computes every price stat over the cars matching every filter, unless a
+// match mode is given. rank orders the suggestions, at most limit of them,
+// defaultSuggestions when 0.
+//
+// With fuzzy matching the make and model filters match the cars of the
+// makes and models they resolve to, once resolved by resolve.
+type searchParams struct {
+	car       dal.Car
+	query     query.Expr
+	match     string
+	tolerance budgetTolerance
+	stats     string
+	rank      ranking
+	limit     int
+	fuzzy     bool
+	makes     []string
+	models    []string
+}
+
+// processor runs the search pipeline over a snapshot. Every stage stops once
+// ctx is done or the pipeline returns, in which case the context error is
+// returned.
+func processor(ctx context.Context, snap *dal.Snapshot, params searchParams) (dal.CarResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// Stops the stages left behind by take
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		return dal.CarResponse{}, err
+	}
+	params = params.resolve(snap)
+	cars := snap.Cars
+	car, expr := params.car, params.query
 
-	generator := func(done <-chan interface{}, size int) <-chan int {
+	generator := func(done <-chan struct{}, size int) <-chan int {
 		intStream := make(chan int)
 		go func() {
 			defer close(intStream)
@@ -134,259 +352,336 @@ func processor(car dal.Car) dal.CarResponse {
 		return intStream
 	}
 
-	filterAll := func(done <-chan interface{}, intStream <-chan int, car dal.Car) <-chan int {
-		matches := make(chan int)
-
+	// indexed streams the positions looked up in the snapshot indexes
+	indexed := func(done <-chan struct{}, positions []int) <-chan int {
+		intStream := make(chan int)
 		go func() {
-			defer close(matches)
-			for i := range intStream {
+			defer close(intStream)
+			for _, i := range positions {
 				select {
 				case <-done:
-				default:
-					if makeMatch(i, car.Make) {
-						matches <- i
-					} else if modelMatch(i, car.Model) {
-						matches <- i
-					} else if budgetMatch(i, car.Price) {
-						matches <- i
-					} else if yearMatch(i, car.Year) {
-						matches <- i
-					}
+					return
+				case intStream <- i:
 				}
 			}
 		}()
-
-		return matches
+		return intStream
 	}
 
-	filterMake := func(done <-chan interface{}, intStream <-chan int, makeName string) <-chan int {
-		if makeName == "" {
-			return intStream
-		}
-
-		filterMakeStream := make(chan int)
+	// filter streams the positions of intStream the cars of which match
+	filter := func(done <-chan struct{}, intStream <-chan int, match func(dal.Car) bool) <-chan int {
+		filterStream := make(chan int)
 		go func() {
-			defer close(filterMakeStream)
+			defer close(filterStream)
 			for i := range intStream {
+				if !match(cars[i]) {
+					continue
+				}
 				select {
 				case <-done:
-				default:
-					if makeMatch(i, makeName) {
-						filterMakeStream <- i
-					}
+					return
+				case filterStream <- i:
 				}
 			}
 		}()
-		return filterMakeStream
+		return filterStream
 	}
 
-	filterModel := func(done <-chan interface{}, intStream <-chan int, modelName string) <-chan int {
-		if modelName == "" {
-			return intStream
+	// scope holds the sorted positions of the cars matching expr
+	var scope []int
+	var inScope []bool
+	if expr != nil {
+		scope = expr.Positions(snap)
+		inScope = make([]bool, len(cars))
+		for _, i := range scope {
+			inScope[i] = true
 		}
+	}
 
-		filterModelName := make(chan int)
-		go func() {
-			defer close(filterModelName)
-			for i := range intStream {
-				select {
-				case <-done:
-				default:
-					if modelMatch(i, modelName) {
-						filterModelName <- i
-					}
+	// scoped narrows sorted positions to the scope of the query
+	scoped := func(positions []int) []int {
+		if expr == nil {
+			return positions
+		}
+		return dal.Intersect(positions, scope)
+	}
 
-				}
+	// priced holds the positions of the cars within budget cheapest first,
+	// every car when no budget is given
+	priced := snap.Index.ByPrice()
+	if car.Price > 0.0 {
+		priced = snap.Index.PriceRange(params.tolerance.window(car.Price))
+	}
+	if expr != nil {
+		var pricedInScope []int
+		for _, i := range priced {
+			if inScope[i] {
+				pricedInScope = append(pricedInScope, i)
 			}
-		}()
-		return filterModelName
+		}
+		priced = pricedInScope
 	}
 
-	filterBudget := func(done <-chan interface{}, intStream <-chan int, budget float32) <-chan int {
-		if budget <= 0.0 {
-			return intStream
+	// anyFilter reports whether any of the filters is given, a query alone
+	// matches every car in its scope
+	anyFilter := car.Make != "" || car.Model != "" || car.Price > 0.0 || car.Year > 0
+
+	// everyCandidate streams the cars matching when no filter is given,
+	// every car in scope with a query or a match mode
+	everyCandidate := func(done <-chan struct{}) <-chan int {
+		if expr == nil && params.match != "" {
+			return generator(done, len(cars))
 		}
+		return indexed(done, scope)
+	}
 
-		filterBudgetAmount := make(chan int)
-		go func() {
-			defer close(filterBudgetAmount)
-			for i := range intStream {
-				select {
-				case <-done:
-				default:
-					if budgetMatch(i, budget) {
-						filterBudgetAmount <- i
-					}
+	// filterLists returns the sorted positions matching each filter given,
+	// as looked up in the indexes
+	filterLists := func(car dal.Car) [][]int {
+		var lists [][]int
+		if car.Price > 0.0 {
+			inBudget := append([]int(nil), priced...)
+			sort.Ints(inBudget)
+			lists = append(lists, inBudget)
+		}
+		if car.Make != "" {
+			lists = append(lists, params.makePositions(snap))
+		}
+		if car.Model != "" {
+			lists = append(lists, params.modelPositions(snap))
+		}
+		if car.Year > 0 {
+			lists = append(lists, snap.Index.Year(car.Year))
+		}
+		return lists
+	}
 
-				}
-			}
-		}()
-		return filterBudgetAmount
+	// anyCandidates streams the cars that may match any of the filters
+	anyCandidates := func(done <-chan struct{}, car dal.Car) <-chan int {
+		if !anyFilter {
+			return everyCandidate(done)
+		}
+		return indexed(done, scoped(dal.Union(filterLists(car)...)))
+	}
+
+	// allCandidates streams the cars that may match every filter
+	allCandidates := func(done <-chan struct{}, car dal.Car) <-chan int {
+		if !anyFilter {
+			return everyCandidate(done)
+		}
+
+		lists := filterLists(car)
+		positions := lists[0]
+		for _, list := range lists[1:] {
+			positions = dal.Intersect(positions, list)
+		}
+		return indexed(done, scoped(positions))
+	}
+
+	// makeModelCandidates streams the cars that may match both the make and
+	// the model, every car when neither is given
+	makeModelCandidates := func(done <-chan struct{}, car dal.Car) <-chan int {
+		switch {
+		case car.Make != "" && car.Model != "":
+			return indexed(done, scoped(dal.Intersect(params.makePositions(snap), params.modelPositions(snap))))
+		case car.Make != "":
+			return indexed(done, scoped(params.makePositions(snap)))
+		case car.Model != "":
+			return indexed(done, scoped(params.modelPositions(snap)))
+		case expr != nil:
+			return indexed(done, scope)
+		}
+		return generator(done, len(cars))
+	}
+
+	filterAll := func(done <-chan struct{}, intStream <-chan int, car dal.Car) <-chan int {
+		return filter(done, intStream, func(c dal.Car) bool {
+			return !anyFilter || params.matchMake(c) || params.matchModel(c) || budgetMatch(c, car.Price, params.tolerance) || yearMatch(c, car.Year)
+		})
+	}
+
+	filterEvery := func(done <-chan struct{}, intStream <-chan int, car dal.Car) <-chan int {
+		return filter(done, intStream, func(c dal.Car) bool {
+			return (car.Make == "" || params.matchMake(c)) &&
+				(car.Model == "" || params.matchModel(c)) &&
+				(car.Price <= 0.0 || budgetMatch(c, car.Price, params.tolerance)) &&
+				(car.Year <= 0 || yearMatch(c, car.Year))
+		})
 	}
 
-	filterDistinctMake := func(done <-chan interface{}, intStream <-chan int, cars []dal.Car) <-chan int {
-		if len(cars) == 0 {
+	filterMake := func(done <-chan struct{}, intStream <-chan int, makeName string) <-chan int {
+		if makeName == "" {
 			return intStream
 		}
+		return filter(done, intStream, func(c dal.Car) bool {
+			return params.matchMake(c)
+		})
+	}
 
-		brands := make(map[string]int)
-		filterDistinctMakeStream := make(chan int)
-		go func() {
-			defer close(filterDistinctMakeStream)
-			for i := range intStream {
-				select {
-				case <-done:
-				default:
-					if _, ok := brands[cars[i].Make]; !ok {
-						brands[cars[i].Make] = i
-						filterDistinctMakeStream <- i
-					}
+	filterModel := func(done <-chan struct{}, intStream <-chan int, modelName string) <-chan int {
+		if modelName == "" {
+			return intStream
+		}
+		return filter(done, intStream, func(c dal.Car) bool {
+			return params.matchModel(c)
+		})
+	}
 
-				}
+	filterDistinctMake := func(done <-chan struct{}, intStream <-chan int) <-chan int {
+		brands := make(map[string]bool)
+		return filter(done, intStream, func(c dal.Car) bool {
+			if brands[c.Make] {
+				return false
 			}
-		}()
-		return filterDistinctMakeStream
+			brands[c.Make] = true
+			return true
+		})
 	}
 
-	take := func(done <-chan interface{}, intStream <-chan int, num int) <-chan int {
+	take := func(done <-chan struct{}, intStream <-chan int, num int) <-chan int {
 		takeStream := make(chan int)
 		go func() {
 			defer close(takeStream)
 			for i := 0; i < num; i++ {
+				var v int
+				var ok bool
 				select {
 				case <-done:
 					return
-				case takeStream <- <-intStream:
+				case v, ok = <-intStream:
+					if !ok {
+						return
+					}
 				}
-			}
-		}()
-		return takeStream
-	}
-
-	/* TODO: Possible solution
-	 for v := range filterYear(done, filterBudget(done, filterMake(done, filterModel(done, generator(done, dbSize), car.Model), car.Make), car.Price), car.Year) {
-		val := dal.CarsDataset[v]
-		log.Println(val)
-		// rest of the code
-	 }
-	*/
-	_ = func(done <-chan interface{}, intStream <-chan int, year int) <-chan int {
-		if year <= 0 {
-			return intStream
-		}
-		filterYear := make(chan int)
-		go func() {
-			defer close(filterYear)
-			for i := range intStream {
 				select {
 				case <-done:
-				default:
-					if yearMatch(i, year) {
-						filterYear <- i
-					}
-
+					return
+				case takeStream <- v:
 				}
 			}
 		}()
-		return filterYear
+		return takeStream
 	}
 
-	done := make(chan interface{})
-	dbSize := len(dal.CarsDataset)
+	done := ctx.Done()
 
 	var totalVehicles int
-	var vehiclePricesCar []dal.Car
 	var totalVehiclesMakeModel int
 
 	// Total Number of vehicles available that matches the faceted search parameters (Our OR operations)
-	for v := range filterAll(done, generator(done, dbSize), car) {
-		val := dal.CarsDataset[v]
+	matches := filterAll(done, anyCandidates(done, car), car)
+	if params.match == matchAll {
+		matches = filterEvery(done, allCandidates(done, car), car)
+	}
+	var matched []bool
+	if params.match != "" {
+		matched = make([]bool, len(cars))
+	}
+	var matchedCars int
+	for v := range matches {
+		val := cars[v]
 		totalVehicles += val.VehicleCount
+		matchedCars++
+		if matched != nil {
+			matched[v] = true
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return dal.CarResponse{}, err
 	}
 
-	// Lowest, Median, and Highest Price of the vehicle that matches the price
-	for v := range filterBudget(done, generator(done, dbSize), car.Price) {
-		val := dal.CarsDataset[v]
-		vehiclePricesCar = append(vehiclePricesCar, val)
+	// With a match mode the stats and suggestions cover the matched cars
+	if matched != nil {
+		priced = nil
+		for _, i := range snap.Index.ByPrice() {
+			if matched[i] {
+				priced = append(priced, i)
+			}
+		}
+	}
+
+	// Weighted stats cover the cars matching every filter, in price order
+	statsPriced := priced
+	if params.stats == statsWeighted && matched == nil {
+		every := params
+		every.match = matchAll
+		statsPriced = inPriceOrder(snap, matching(snap, every))
 	}
 
-	resp := findStatsStruct(vehiclePricesCar)
+	// Lowest, Median, and Highest Price of the vehicle that matches the price
+	resp := findStatsStruct(cars, statsPriced)
+	if params.stats == statsWeighted {
+		resp.PriceStats = dal.WeightedPriceStats(cars, statsPriced)
+	}
 	resp.TotalVehicles = totalVehicles
+	resp.Match = params.match
+	resp.Rank = params.rank.strategy
+	resp.Resolved = params.resolved()
+	if car.Price > 0.0 {
+		resp.BudgetWindow = params.tolerance.budgetWindow(car.Price)
+	}
 
 	// Number of vehicles matched by Make and Model combination as a sub-group of Total Number
-	for v := range filterModel(done, filterMake(done, generator(done, dbSize), car.Make), car.Model) {
-		val := dal.CarsDataset[v]
+	for v := range filterModel(done, filterMake(done, makeModelCandidates(done, car), car.Make), car.Model) {
+		val := cars[v]
 		totalVehiclesMakeModel += val.VehicleCount
 	}
+	if err := ctx.Err(); err != nil {
+		return dal.CarResponse{}, err
+	}
 
 	resp.MakeModelTotalVehicles = totalVehiclesMakeModel
 
-	resultSorted := mergeSort(vehiclePricesCar)
-	// 5 Suggested vehicles that are within a given budget.
-	for num := range take(done, filterDistinctMake(done, generator(done, dbSize), resultSorted), 5) {
-		resp.Suggestions = append(resp.Suggestions, resultSorted[num])
+	// Suggested vehicles that are within a given budget, best ranked first
+	limit := params.limit
+	if limit <= 0 {
+		limit = defaultSuggestions
+	}
+	ranked := params.rank.rank(cars, priced, car.Price)
+	for num := range take(done, filterDistinctMake(done, indexed(done, ranked)), limit) {
+		resp.Suggestions = append(resp.Suggestions, cars[num])
+	}
+	if err := ctx.Err(); err != nil {
+		return dal.CarResponse{}, err
+	}
+
+	// A search matching no car, or with a filter matching no car, gets
+	// alternatives, so that a misspelt make is caught even when another
+	// filter matches
+	if matchedCars == 0 && (anyFilter || expr != nil) || emptyFilter(snap, params) {
+		resp.DidYouMean = didYouMean(snap, params)
+		if err := ctx.Err(); err != nil {
+			return dal.CarResponse{}, err
+		}
 	}
 
-	return resp
+	return resp, nil
 }
 
-func makeMatch(index int, makeName string) bool {
-	return makeName != "" && strings.Contains(dal.CarsDataset[index].Make, makeName)
+func makeMatch(car dal.Car, makeName string) bool {
+	return makeName != "" && strings.Contains(car.Make, makeName)
 }
 
-func modelMatch(index int, modelName string) bool {
-	return modelName != "" && strings.Contains(dal.CarsDataset[index].Model, modelName)
+func modelMatch(car dal.Car, modelName string) bool {
+	return modelName != "" && strings.Contains(car.Model, modelName)
 }
 
-func budgetMatch(index int, budget float32) bool {
-	above := budget * 1.10
-	below := budget * 0.9
-	return budget > 0.0 && dal.CarsDataset[index].Price < above && dal.CarsDataset[index].Price > below
+func budgetMatch(car dal.Car, budget float32, tolerance budgetTolerance) bool {
+	below, above := tolerance.window(budget)
+	return budget > 0.0 && car.Price < above && car.Price > below
 }
 
-func yearMatch(index, year int) bool {
-	return year > 0 && dal.CarsDataset[index].Year == year
+func yearMatch(car dal.Car, year int) bool {
+	return year > 0 && car.Year == year
 }
 
-func findStatsStruct(carPrices []dal.Car) dal.CarResponse {
-	if len(carPrices) == 0 {
+// findStatsStruct returns the price stats of the cars at positions, which
+// are ordered by price
+func findStatsStruct(cars []dal.Car, positions []int) dal.CarResponse {
+	if len(positions) == 0 {
 		return dal.CarResponse{Lowest: 0, Median: 0, Highest: 0}
 	}
-	result := mergeSort(carPrices)
-	length := len(carPrices)
+	length := len(positions)
 	median := length / 2
-	return dal.CarResponse{Lowest: result[0].Price, Median: result[median].Price, Highest: result[length-1].Price}
-}
-
-func mergeSort(arrCar []dal.Car) []dal.Car {
-	if len(arrCar) <= 1 {
-		return arrCar
-	}
-
-	middle := len(arrCar) / 2
-	left := mergeSort(arrCar[:middle])
-	right := mergeSort(arrCar[middle:])
-	return merge(left, right)
-}
-
-func merge(left, right []dal.Car) []dal.Car {
-	result := make([]dal.Car, len(left)+len(right))
-	for i := 0; len(left) > 0 || len(right) > 0; i++ {
-		if len(left) > 0 && len(right) > 0 {
-			if left[0].Price < right[0].Price {
-				result[i] = left[0]
-				left = left[1:]
-			} else {
-				result[i] = right[0]
-				right = right[1:]
-			}
-		} else if len(left) > 0 {
-			result[i] = left[0]
-			left = left[1:]
-		} else if len(right) > 0 {
-			result[i] = right[0]
-			right = right[1:]
-		}
-	}
-	return result
+	return dal.CarResponse{Lowest: cars[positions[0]].Price, Median: cars[positions[median]].Price, Highest: cars[positions[length-1]].Price}
 }
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// maxPriceQuantiles limits the number of quantile buckets of a histogram
+const maxPriceQuantiles = 100
+
+// Bucketing modes of a price histogram
+const (
+	bucketsWidth    = "width"
+	bucketsEdges    = "edges"
+	bucketsQuantile = "quantile"
+)
+
+// priceHistogram defines the distribution of the prices of the cars
+// matching a search
+type priceHistogram struct {
+	Mode     string        `json:"mode"`
+	Cars     int           `json:"cars"`
+	Vehicles int           `json:"vehicles"`
+	Lowest   float32       `json:"lowest"`
+	Highest  float32       `json:"highest"`
+	Buckets  []priceBucket `json:"buckets"`
+}
+
+// GetPriceHistogram defines a GET handler bucketing the prices of the cars
+// matching the search filters. Buckets are fixed width, between the given
+// edges or between quantiles of the matching prices.
+func (h *httpServer) GetPriceHistogram(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	params, err := h.parseSearch(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.match == "" {
+		params.match = matchAll
+	}
+
+	quantiles, err := parseQuantiles(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	buckets, err := parsePriceBuckets(vars, "price_buckets", "price_bucket_width")
+	if err == nil && quantiles > 0 && (vars.Get("price_buckets") != "" || vars.Get("price_bucket_width") != "") {
+		err = fmt.Errorf("price_quantiles is exclusive with price_buckets and price_bucket_width")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	snap := h.store.Snapshot()
+	positions := matching(snap, params)
+	done := ctx.Done()
+	prices := make([]float32, len(positions))
+	for k, i := range positions {
+		if cancelled(done) {
+			h.writeProcessorError(w, r, ctx.Err())
+			return
+		}
+		prices[k] = snap.Cars[i].Price
+	}
+	sort.Slice(prices, func(a, b int) bool { return prices[a] < prices[b] })
+
+	result := priceHistogram{Mode: bucketsWidth, Cars: len(positions), Buckets: []priceBucket{}}
+	switch {
+	case quantiles > 0:
+		result.Mode = bucketsQuantile
+		buckets = priceBuckets{edges: quantileEdges(prices, quantiles)}
+	case buckets.width == 0:
+		result.Mode = bucketsEdges
+	}
+	if len(prices) > 0 {
+		result.Lowest, result.Highest = prices[0], prices[len(prices)-1]
+	}
+
+	counter := newPriceCounter(buckets)
+	for _, i := range positions {
+		if cancelled(done) {
+			h.writeProcessorError(w, r, ctx.Err())
+			return
+		}
+		car := snap.Cars[i]
+		result.Vehicles += car.VehicleCount
+		counter.add(car.Price, car.VehicleCount)
+	}
+	if err := ctx.Err(); err != nil {
+		h.writeProcessorError(w, r, err)
+		return
+	}
+
+	// Quantiles of no prices hold no bucket
+	if result.Mode != bucketsQuantile || len(prices) > 0 {
+		result.Buckets, err = counter.result()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	// Quantiles start at the lowest price, nothing is below
+	if result.Mode == bucketsQuantile && len(prices) > 0 && buckets.edges[0] > 0 {
+		result.Buckets = result.Buckets[1:]
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parseQuantiles returns the number of quantile buckets requested, 0 when
+// none is
+func parseQuantiles(vars url.Values) (int, error) {
+	value := vars.Get("price_quantiles")
+	if value == "" {
+		return 0, nil
+	}
+	quantiles, err := strconv.Atoi(value)
+	if err != nil || quantiles < 2 || quantiles > maxPriceQuantiles {
+		return 0, fmt.Errorf("price_quantiles must be between 2 and %d: %s", maxPriceQuantiles, value)
+	}
+	return quantiles, nil
+}
+
+// quantileEdges returns the edges splitting sorted prices into quantiles
+// holding as many cars as possible from the lowest price, equal edges are
+// merged
+func quantileEdges(prices []float32, quantiles int) []float32 {
+	if len(prices) == 0 {
+		return nil
+	}
+	edges := []float32{prices[0]}
+	for k := 1; k < quantiles; k++ {
+		edge := prices[k*len(prices)/quantiles]
+		if edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
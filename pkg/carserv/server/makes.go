@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// catalogEntry defines a make or model of the inventory along with its
+// number of vehicles and the years of its cars
+type catalogEntry struct {
+	vehicles int
+	years    map[int]bool
+}
+
+func (e *catalogEntry) add(car dal.Car) {
+	e.vehicles += car.VehicleCount
+	if e.years == nil {
+		e.years = make(map[int]bool)
+	}
+	e.years[car.Year] = true
+}
+
+func (e *catalogEntry) sortedYears() []int {
+	years := make([]int, 0, len(e.years))
+	for year := range e.years {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	return years
+}
+
+// makeSummary defines a make of the inventory
+type makeSummary struct {
+	Make     string `json:"make"`
+	Vehicles int    `json:"vehicles"`
+	Years    []int  `json:"years"`
+}
+
+// modelSummary defines a model of a make of the inventory
+type modelSummary struct {
+	Model    string `json:"model"`
+	Vehicles int    `json:"vehicles"`
+	Years    []int  `json:"years"`
+}
+
+// makeModels defines the models of a make, the make being spelt as in the
+// inventory
+type makeModels struct {
+	Make   string         `json:"make"`
+	Models []modelSummary `json:"models"`
+}
+
+// GetMakes defines a GET handler listing the makes of the inventory along
+// with their number of vehicles and the years of their cars, sorted by make
+func (h *httpServer) GetMakes(w http.ResponseWriter, r *http.Request) {
+	snap := h.store.Snapshot()
+	entries := make(map[string]*catalogEntry)
+	for _, car := range snap.Cars {
+		if entries[car.Make] == nil {
+			entries[car.Make] = &catalogEntry{}
+		}
+		entries[car.Make].add(car)
+	}
+
+	result := make([]makeSummary, 0, len(entries))
+	for name, entry := range entries {
+		result = append(result, makeSummary{Make: name, Vehicles: entry.vehicles, Years: entry.sortedYears()})
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].Make < result[b].Make })
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetModels defines a GET handler listing the models of a make along with
+// their number of vehicles and the years of their cars, sorted by model. The
+// make may be an alias and is matched whatever its case and diacritics.
+func (h *httpServer) GetModels(w http.ResponseWriter, r *http.Request) {
+	makeName := mux.Vars(r)["make"]
+	folded := dal.Fold(h.aliases.Canonical(dal.AliasMakes, makeName))
+
+	snap := h.store.Snapshot()
+	result := makeModels{Models: []modelSummary{}}
+	entries := make(map[string]*catalogEntry)
+	for _, i := range snap.Index.MakeFolded(folded) {
+		car := snap.Cars[i]
+		if result.Make == "" || car.Make < result.Make {
+			result.Make = car.Make
+		}
+		if entries[car.Model] == nil {
+			entries[car.Model] = &catalogEntry{}
+		}
+		entries[car.Model].add(car)
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("make not found: %s", makeName))
+		return
+	}
+
+	for name, entry := range entries {
+		result.Models = append(result.Models, modelSummary{Model: name, Vehicles: entry.vehicles, Years: entry.sortedYears()})
+	}
+	sort.Slice(result.Models, func(a, b int) bool { return result.Models[a].Model < result.Models[b].Model })
+	writeJSON(w, http.StatusOK, result)
+}
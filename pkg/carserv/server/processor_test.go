@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// processorQueries are the queries compared and benchmarked against the scan
+// based processor
+var processorQueries = []struct {
+	name string
+	car  dal.Car
+}{
+	{name: "Budget", car: dal.Car{Price: 30000}},
+	{name: "MakeModelBudget", car: dal.Car{Make: "Ford", Model: "F-150", Price: 45000}},
+	{name: "MakeYear", car: dal.Car{Make: "Toyota", Year: 2019}},
+	{name: "Empty", car: dal.Car{}},
+}
+
+func TestProcessorMatchesScan(t *testing.T) {
+	snap := dal.NewSnapshot(dal.CarsDataset)
+	for _, tc := range processorQueries {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := scanProcessor(snap.Cars, tc.car)
+			got, err := processor(context.Background(), snap, searchParams{car: tc.car, tolerance: defaultBudgetTolerance})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The scan based processor predates budget windows
+			got.BudgetWindow = nil
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected: %v, Got: %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestProcessorCancelled(t *testing.T) {
+	snap := dal.NewSnapshot(dal.CarsDataset)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := processor(ctx, snap, searchParams{car: dal.Car{Price: 30000}, tolerance: defaultBudgetTolerance}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected: %v, Got: %v", context.Canceled, err)
+	}
+}
+
+func TestProcessorStopsStages(t *testing.T) {
+	snap := dal.NewSnapshot(scaledDataset(4))
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		// take stops the suggestions early, leaving stages to be stopped
+		if _, err := processor(context.Background(), snap, searchParams{car: dal.Car{Make: "Ford"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stopped stages exit asynchronously
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected the pipeline goroutines to exit, %d left running", after-before)
+	}
+}
+
+func BenchmarkProcessor(b *testing.B) {
+	for _, scale := range []int{1, 64} {
+		cars := scaledDataset(scale)
+		snap := dal.NewSnapshot(cars)
+		for _, tc := range processorQueries {
+			b.Run(fmt.Sprintf("%s/x%d/Indexed", tc.name, scale), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					processor(context.Background(), snap, searchParams{car: tc.car, tolerance: defaultBudgetTolerance})
+				}
+			})
+			b.Run(fmt.Sprintf("%s/x%d/Scan", tc.name, scale), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					scanProcessor(cars, tc.car)
+				}
+			})
+		}
+	}
+}
+
+// scaledDataset repeats the dataset scale times with the prices spread so
+// the copies do not collide
+func scaledDataset(scale int) []dal.Car {
+	cars := make([]dal.Car, 0, len(dal.CarsDataset)*scale)
+	for n := 0; n < scale; n++ {
+		for _, car := range dal.CarsDataset {
+			car.Price += float32(n)
+			cars = append(cars, car)
+		}
+	}
+	return cars
+}
+
+// scanProcessor is the processor before the snapshot indexes, scanning and
+// sorting every car of the dataset on each request
+func scanProcessor(cars []dal.Car, car dal.Car) dal.CarResponse {
+	generator := func(done <-chan interface{}, size int) <-chan int {
+		intStream := make(chan int)
+		go func() {
+			defer close(intStream)
+			for i := 0; i < size; i++ {
+				select {
+				case <-done:
+					return
+				case intStream <- i:
+				}
+			}
+		}()
+		return intStream
+	}
+
+	filterAll := func(done <-chan interface{}, intStream <-chan int, car dal.Car) <-chan int {
+		matches := make(chan int)
+
+		go func() {
+			defer close(matches)
+			for i := range intStream {
+				select {
+				case <-done:
+				default:
+					if makeMatch(cars[i], car.Make) {
+						matches <- i
+					} else if modelMatch(cars[i], car.Model) {
+						matches <- i
+					} else if budgetMatch(cars[i], car.Price, defaultBudgetTolerance) {
+						matches <- i
+					} else if yearMatch(cars[i], car.Year) {
+						matches <- i
+					}
+				}
+			}
+		}()
+
+		return matches
+	}
+
+	filterMake := func(done <-chan interface{}, intStream <-chan int, makeName string) <-chan int {
+		if makeName == "" {
+			return intStream
+		}
+
+		filterMakeStream := make(chan int)
+		go func() {
+			defer close(filterMakeStream)
+			for i := range intStream {
+				select {
+				case <-done:
+				default:
+					if makeMatch(cars[i], makeName) {
+						filterMakeStream <- i
+					}
+				}
+			}
+		}()
+		return filterMakeStream
+	}
+
+	filterModel := func(done <-chan interface{}, intStream <-chan int, modelName string) <-chan int {
+		if modelName == "" {
+			return intStream
+		}
+
+		filterModelName := make(chan int)
+		go func() {
+			defer close(filterModelName)
+			for i := range intStream {
+				select {
+				case <-done:
+				default:
+					if modelMatch(cars[i], modelName) {
+						filterModelName <- i
+					}
+
+				}
+			}
+		}()
+		return filterModelName
+	}
+
+	filterBudget := func(done <-chan interface{}, intStream <-chan int, budget float32) <-chan int {
+		if budget <= 0.0 {
+			return intStream
+		}
+
+		filterBudgetAmount := make(chan int)
+		go func() {
+			defer close(filterBudgetAmount)
+			for i := range intStream {
+				select {
+				case <-done:
+				default:
+					if budgetMatch(cars[i], budget, defaultBudgetTolerance) {
+						filterBudgetAmount <- i
+					}
+
+				}
+			}
+		}()
+		return filterBudgetAmount
+	}
+
+	filterDistinctMake := func(done <-chan interface{}, intStream <-chan int, sorted []dal.Car) <-chan int {
+		if len(sorted) == 0 {
+			return intStream
+		}
+
+		brands := make(map[string]int)
+		filterDistinctMakeStream := make(chan int)
+		go func() {
+			defer close(filterDistinctMakeStream)
+			for i := range intStream {
+				select {
+				case <-done:
+				default:
+					if _, ok := brands[sorted[i].Make]; !ok {
+						brands[sorted[i].Make] = i
+						filterDistinctMakeStream <- i
+					}
+
+				}
+			}
+		}()
+		return filterDistinctMakeStream
+	}
+
+	take := func(done <-chan interface{}, intStream <-chan int, num int) <-chan int {
+		takeStream := make(chan int)
+		go func() {
+			defer close(takeStream)
+			for i := 0; i < num; i++ {
+				v, ok := <-intStream
+				if !ok {
+					return
+				}
+				select {
+				case <-done:
+					return
+				case takeStream <- v:
+				}
+			}
+		}()
+		return takeStream
+	}
+
+	done := make(chan interface{})
+	dbSize := len(cars)
+
+	var totalVehicles int
+	var vehiclePricesCar []dal.Car
+	var totalVehiclesMakeModel int
+
+	// Total Number of vehicles available that matches the faceted search parameters (Our OR operations)
+	for v := range filterAll(done, generator(done, dbSize), car) {
+		val := cars[v]
+		totalVehicles += val.VehicleCount
+	}
+
+	// Lowest, Median, and Highest Price of the vehicle that matches the price
+	for v := range filterBudget(done, generator(done, dbSize), car.Price) {
+		val := cars[v]
+		vehiclePricesCar = append(vehiclePricesCar, val)
+	}
+
+	resp := scanStats(vehiclePricesCar)
+	resp.TotalVehicles = totalVehicles
+
+	// Number of vehicles matched by Make and Model combination as a sub-group of Total Number
+	for v := range filterModel(done, filterMake(done, generator(done, dbSize), car.Make), car.Model) {
+		val := cars[v]
+		totalVehiclesMakeModel += val.VehicleCount
+	}
+
+	resp.MakeModelTotalVehicles = totalVehiclesMakeModel
+
+	resultSorted := mergeSort(vehiclePricesCar)
+	if len(resultSorted) == 0 {
+		return resp
+	}
+	// 5 Suggested vehicles that are within a given budget.
+	for num := range take(done, filterDistinctMake(done, generator(done, len(resultSorted)), resultSorted), 5) {
+		resp.Suggestions = append(resp.Suggestions, resultSorted[num])
+	}
+
+	return resp
+}
+
+func scanStats(carPrices []dal.Car) dal.CarResponse {
+	if len(carPrices) == 0 {
+		return dal.CarResponse{Lowest: 0, Median: 0, Highest: 0}
+	}
+	result := mergeSort(carPrices)
+	length := len(carPrices)
+	median := length / 2
+	return dal.CarResponse{Lowest: result[0].Price, Median: result[median].Price, Highest: result[length-1].Price}
+}
+
+func mergeSort(arrCar []dal.Car) []dal.Car {
+	if len(arrCar) <= 1 {
+		return arrCar
+	}
+
+	middle := len(arrCar) / 2
+	left := mergeSort(arrCar[:middle])
+	right := mergeSort(arrCar[middle:])
+	return merge(left, right)
+}
+
+func merge(left, right []dal.Car) []dal.Car {
+	result := make([]dal.Car, len(left)+len(right))
+	for i := 0; len(left) > 0 || len(right) > 0; i++ {
+		if len(left) > 0 && len(right) > 0 {
+			if left[0].Price < right[0].Price {
+				result[i] = left[0]
+				left = left[1:]
+			} else {
+				result[i] = right[0]
+				right = right[1:]
+			}
+		} else if len(left) > 0 {
+			result[i] = left[0]
+			left = left[1:]
+		} else if len(right) > 0 {
+			result[i] = right[0]
+			right = right[1:]
+		}
+	}
+	return result
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+// Ranking strategies of the suggestions
+const (
+	// rankCheapest suggests the cheapest cars first
+	rankCheapest = "cheapest"
+	// rankClosestToBudget suggests the cars priced closest to the budget
+	// first
+	rankClosestToBudget = "closest_to_budget"
+	// rankNewest suggests the most recent cars first
+	rankNewest = "newest"
+	// rankMostAvailable suggests the cars with the most vehicles first
+	rankMostAvailable = "most_available"
+	// rankBalanced weighs the budget closeness, year and vehicles of the
+	// cars together
+	rankBalanced = "balanced"
+)
+
+const (
+	// defaultSuggestions is the number of suggestions unless set by a request
+	defaultSuggestions = 5
+	// maxSuggestions limits the number of suggestions of a response
+	maxSuggestions = 50
+)
+
+// rankWeights defines the weight of each score of a balanced ranking
+type rankWeights struct {
+	budget   float64
+	year     float64
+	vehicles float64
+}
+
+// defaultRankWeights favours budget closeness over year and vehicles
+var defaultRankWeights = rankWeights{budget: 0.5, year: 0.25, vehicles: 0.25}
+
+// ranking defines the order of the suggestions
+type ranking struct {
+	strategy string
+	weights  rankWeights
+}
+
+// strategyWeights returns the weights of the scores of a strategy, nil for
+// the cheapest cars first
+func (r ranking) strategyWeights() *rankWeights {
+	switch r.strategy {
+	case rankClosestToBudget:
+		return &rankWeights{budget: 1}
+	case rankNewest:
+		return &rankWeights{year: 1}
+	case rankMostAvailable:
+		return &rankWeights{vehicles: 1}
+	case rankBalanced:
+		return &r.weights
+	}
+	return nil
+}
+
+// rank returns the candidates, ordered by price, best ranked first. Each
+// score ranges from 0 for the worst candidate to 1 for the best, ties keep
+// the cheapest car first. Without a budget no car is closer to it.
+func (r ranking) rank(cars []dal.Car, candidates []int, budget float32) []int {
+	weights := r.strategyWeights()
+	if weights == nil || len(candidates) == 0 {
+		return candidates
+	}
+
+	distance := func(car dal.Car) float64 {
+		return math.Abs(float64(car.Price) - float64(budget))
+	}
+	var farthest float64
+	minYear, maxYear := cars[candidates[0]].Year, cars[candidates[0]].Year
+	minVehicles, maxVehicles := cars[candidates[0]].VehicleCount, cars[candidates[0]].VehicleCount
+	for _, i := range candidates {
+		car := cars[i]
+		farthest = math.Max(farthest, distance(car))
+		if car.Year < minYear {
+			minYear = car.Year
+		}
+		if car.Year > maxYear {
+			maxYear = car.Year
+		}
+		if car.VehicleCount < minVehicles {
+			minVehicles = car.VehicleCount
+		}
+		if car.VehicleCount > maxVehicles {
+			maxVehicles = car.VehicleCount
+		}
+	}
+	// normalize scales value to its share of the candidates range
+	normalize := func(value, low, high float64) float64 {
+		if high <= low {
+			return 1
+		}
+		return (value - low) / (high - low)
+	}
+
+	scores := make(map[int]float64, len(candidates))
+	for _, i := range candidates {
+		car := cars[i]
+		var score float64
+		if budget > 0.0 {
+			score += weights.budget * (1 - normalize(distance(car), 0, farthest))
+		}
+		score += weights.year * normalize(float64(car.Year), float64(minYear), float64(maxYear))
+		score += weights.vehicles * normalize(float64(car.VehicleCount), float64(minVehicles), float64(maxVehicles))
+		scores[i] = score
+	}
+
+	ranked := append([]int(nil), candidates...)
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return scores[ranked[a]] > scores[ranked[b]]
+	})
+	return ranked
+}
+
+// parseRank returns the ranking of a search given by the rank parameter,
+// the weight_budget, weight_year and weight_vehicles parameters override the
+// default weights of a balanced ranking
+func parseRank(vars url.Values, defaults rankWeights) (ranking, error) {
+	r := ranking{strategy: vars.Get("rank"), weights: defaults}
+	switch r.strategy {
+	case "", rankCheapest, rankClosestToBudget, rankNewest, rankMostAvailable, rankBalanced:
+	default:
+		return ranking{}, fmt.Errorf("rank must be %s, %s, %s, %s or %s: %s",
+			rankCheapest, rankClosestToBudget, rankNewest, rankMostAvailable, rankBalanced, r.strategy)
+	}
+
+	for _, param := range []struct {
+		name  string
+		field *float64
+	}{
+		{name: "weight_budget", field: &r.weights.budget},
+		{name: "weight_year", field: &r.weights.year},
+		{name: "weight_vehicles", field: &r.weights.vehicles},
+	} {
+		value := vars.Get(param.name)
+		if value == "" {
+			continue
+		}
+		if r.strategy != rankBalanced {
+			return ranking{}, fmt.Errorf("%s only applies to rank=%s", param.name, rankBalanced)
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(weight >= 0) || math.IsInf(weight, 0) {
+			return ranking{}, fmt.Errorf("%s must be a non-negative number: %s", param.name, value)
+		}
+		*param.field = weight
+	}
+	if r.weights.budget+r.weights.year+r.weights.vehicles <= 0 {
+		return ranking{}, errors.New("at least one of weight_budget, weight_year and weight_vehicles must be positive")
+	}
+	return r, nil
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchPage defines a page of search results, Total counts every match
+type searchPage struct {
+	Cars       []carRecord `json:"cars"`
+	Total      int         `json:"total"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// searchSort defines the order of search results, by the key of a field and
+// then by id
+type searchSort struct {
+	name string
+	desc bool
+	key  func(dal.Car) float64
+}
+
+// searchCursor defines the sort key and id of the last car of a page. Pages
+// resume after it, so that cars written between pages neither repeat nor
+// shift the cars after it.
+type searchCursor struct {
+	Sort string  `json:"s"`
+	Key  float64 `json:"k"`
+	ID   int     `json:"id"`
+}
+
+// SearchCars defines a GET handler listing the cars matching the search
+// filters, a page at a time
+func (h *httpServer) SearchCars(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	params, err := h.parseSearch(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.match == "" {
+		params.match = matchAll
+	}
+
+	order, err := parseSort(vars.Get("sort"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseLimit(vars, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cursor, err := parseCursor(vars.Get("cursor"), order)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	snap := h.store.Snapshot()
+	positions := matching(snap, params)
+
+	// Only the page and the car telling whether another page follows are
+	// kept in order
+	done := ctx.Done()
+	page := newTopK(limit+1, func(a, b int) bool {
+		carA, carB := snap.Cars[a], snap.Cars[b]
+		return order.compare(order.key(carA), carA.ID, order.key(carB), carB.ID) < 0
+	})
+	for _, i := range positions {
+		if cancelled(done) {
+			h.writeProcessorError(w, r, ctx.Err())
+			return
+		}
+		car := snap.Cars[i]
+		if cursor == nil || order.compare(order.key(car), car.ID, cursor.Key, cursor.ID) > 0 {
+			page.offer(i)
+		}
+	}
+	rows := make([]dal.Car, 0, limit+1)
+	for _, i := range page.sorted() {
+		rows = append(rows, snap.Cars[i])
+	}
+
+	result := searchPage{Cars: []carRecord{}, Total: len(positions)}
+	if len(rows) > limit {
+		last := rows[limit-1]
+		result.NextCursor = encodeCursor(searchCursor{Sort: order.name, Key: order.key(last), ID: last.ID})
+		rows = rows[:limit]
+	}
+	for _, car := range rows {
+		result.Cars = append(result.Cars, newCarRecord(car))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// cancelled tells whether the request context whose done channel is given
+// is over, so that handler loops stop early rather than discard their result
+func cancelled(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// matching returns the sorted positions of the cars of snap matching the
+// filters of params, every filter unless the match mode is any, narrowed to
+// its query. Every car in scope matches when no filter is given.
+func matching(snap *dal.Snapshot, params searchParams) []int {
+	params = params.resolve(snap)
+	car := params.car
+	var lists [][]int
+	if car.Price > 0.0 {
+		inBudget := snap.Index.PriceRange(params.tolerance.window(car.Price))
+		sort.Ints(inBudget)
+		lists = append(lists, inBudget)
+	}
+	if car.Make != "" {
+		lists = append(lists, params.makePositions(snap))
+	}
+	if car.Model != "" {
+		lists = append(lists, params.modelPositions(snap))
+	}
+	if car.Year > 0 {
+		lists = append(lists, snap.Index.Year(car.Year))
+	}
+
+	var positions []int
+	switch {
+	case len(lists) == 0 && params.query != nil:
+		return params.query.Positions(snap)
+	case len(lists) == 0:
+		positions = make([]int, len(snap.Cars))
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions
+	case params.match == matchAny:
+		positions = dal.Union(lists...)
+	default:
+		positions = lists[0]
+		for _, list := range lists[1:] {
+			positions = dal.Intersect(positions, list)
+		}
+	}
+
+	if params.query != nil {
+		positions = dal.Intersect(positions, params.query.Positions(snap))
+	}
+	return positions
+}
+
+// inPriceOrder returns sorted positions of snap ordered by price then
+// position
+func inPriceOrder(snap *dal.Snapshot, positions []int) []int {
+	in := make([]bool, len(snap.Cars))
+	for _, i := range positions {
+		in[i] = true
+	}
+	priced := make([]int, 0, len(positions))
+	for _, i := range snap.Index.ByPrice() {
+		if in[i] {
+			priced = append(priced, i)
+		}
+	}
+	return priced
+}
+
+// parseSort returns the order given by the sort parameter, a field name
+// prefixed with - for a descending order. Results are sorted by price by
+// default.
+func parseSort(value string) (searchSort, error) {
+	order := searchSort{name: value}
+	field := strings.TrimPrefix(value, "-")
+	order.desc = field != value
+	switch {
+	case value == "-":
+		return order, fmt.Errorf("sort must name a field after -: %s", value)
+	case field == "", field == "price":
+		order.key = func(car dal.Car) float64 { return float64(car.Price) }
+	case field == "year":
+		order.key = func(car dal.Car) float64 { return float64(car.Year) }
+	case field == "vehicle_count":
+		order.key = func(car dal.Car) float64 { return float64(car.VehicleCount) }
+	default:
+		return order, fmt.Errorf("sort must be price, year or vehicle_count, optionally prefixed with -: %s", value)
+	}
+	if order.name == "" {
+		order.name = "price"
+	}
+	return order, nil
+}
+
+// compare orders two cars given their sort keys and ids
+func (o searchSort) compare(keyA float64, idA int, keyB float64, idB int) int {
+	switch {
+	case keyA < keyB && !o.desc, keyA > keyB && o.desc:
+		return -1
+	case keyA != keyB:
+		return 1
+	case idA < idB:
+		return -1
+	case idA > idB:
+		return 1
+	}
+	return 0
+}
+
+// parseLimit returns the limit parameter, between 1 and max
+func parseLimit(vars url.Values, def, max int) (int, error) {
+	value := vars.Get("limit")
+	if value == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > max {
+		return 0, fmt.Errorf("limit must be between 1 and %d: %s", max, value)
+	}
+	return limit, nil
+}
+
+// parseCursor decodes a cursor returned with a previous page, which must
+// have been sorted the same way
+func parseCursor(value string, order searchSort) (*searchCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if cursor.Sort != order.name {
+		return nil, fmt.Errorf("cursor was issued for sort=%s, not sort=%s", cursor.Sort, order.name)
+	}
+	return &cursor, nil
+}
+
+func encodeCursor(cursor searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
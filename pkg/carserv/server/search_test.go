@@ -0,0 +1,538 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+func TestSearchCars(t *testing.T) {
+	ts, store := newTestServer(t, testCars)
+
+	search := func(t *testing.T, path string, statusCode int) searchPage {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != statusCode {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("Expected status: %d, Got: %d %s", statusCode, resp.StatusCode, body)
+		}
+		var page searchPage
+		if statusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return page
+	}
+	ids := func(page searchPage) []int {
+		var ids []int
+		for _, car := range page.Cars {
+			ids = append(ids, car.ID)
+		}
+		return ids
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		first := search(t, "/cars/search?make=Ford&sort=-price&limit=2", http.StatusOK)
+		if expected := []int{2, 1}; !reflect.DeepEqual(ids(first), expected) || first.Total != 3 || first.NextCursor == "" {
+			t.Fatalf("Expected cars %v of 3 and a cursor, Got: %v of %d %q", expected, ids(first), first.Total, first.NextCursor)
+		}
+
+		// A car sorted before the cursor does not shift the next page
+		if _, err := store.Create(dal.Car{Make: "Ford", Model: "Ranger", Year: 2021, VehicleCount: 2, Price: 35000}); err != nil {
+			t.Fatal(err)
+		}
+
+		second := search(t, "/cars/search?make=Ford&sort=-price&limit=2&cursor="+first.NextCursor, http.StatusOK)
+		if expected := []int{4}; !reflect.DeepEqual(ids(second), expected) || second.NextCursor != "" {
+			t.Errorf("Expected cars %v and no cursor, Got: %v %q", expected, ids(second), second.NextCursor)
+		}
+
+		search(t, "/cars/search?make=Ford&sort=year&cursor="+first.NextCursor, http.StatusBadRequest)
+	})
+
+	t.Run("MatchAny", func(t *testing.T) {
+		page := search(t, "/cars/search?make=Kia&year=2019&match=any&sort=year", http.StatusOK)
+		if expected := []int{1, 3, 5}; !reflect.DeepEqual(ids(page), expected) {
+			t.Errorf("Expected: %v, Got: %v", expected, ids(page))
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		page := search(t, "/cars/search?q=vehicle_count>4&sort=-vehicle_count", http.StatusOK)
+		if expected := []int{1, 3, 5}; !reflect.DeepEqual(ids(page), expected) {
+			t.Errorf("Expected: %v, Got: %v", expected, ids(page))
+		}
+	})
+
+	for _, path := range []string{
+		"/cars/search?sort=colour",
+		"/cars/search?sort=-",
+		"/cars/search?limit=0",
+		"/cars/search?limit=101",
+		"/cars/search?cursor=garbage",
+		"/cars/search?year=-1",
+	} {
+		t.Run(path, func(t *testing.T) {
+			search(t, path, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestGetFacets(t *testing.T) {
+	ts, _ := newTestServer(t, testCars)
+
+	price := func(p float32) *float32 {
+		return &p
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		expected   facets
+	}{
+		{
+			name:       "Edges",
+			path:       "/cars/facets?year_min=2018&price_buckets=20000,40000",
+			statusCode: http.StatusOK,
+			expected: facets{
+				Vehicles: 26,
+				Make:     []facetCount{{Value: "Ford", Vehicles: 14}, {Value: "Honda", Vehicles: 7}, {Value: "Kia", Vehicles: 5}},
+				Model:    []facetCount{{Value: "F-150", Vehicles: 10}, {Value: "Civic", Vehicles: 7}, {Value: "Soul", Vehicles: 5}, {Value: "Transit Van", Vehicles: 4}},
+				Year:     []yearCount{{Value: 2019, Vehicles: 17}, {Value: 2020, Vehicles: 9}},
+				Price: []priceBucket{
+					{Min: 0, Max: price(20000), Cars: 1, Vehicles: 5},
+					{Min: 20000, Max: price(40000), Cars: 2, Vehicles: 17},
+					{Min: 40000, Cars: 1, Vehicles: 4},
+				},
+			},
+		},
+		{
+			name:       "Width",
+			path:       "/cars/facets?make=Ford",
+			statusCode: http.StatusOK,
+			expected: facets{
+				Vehicles: 17,
+				Make:     []facetCount{{Value: "Ford", Vehicles: 17}},
+				Model:    []facetCount{{Value: "F-150", Vehicles: 10}, {Value: "Transit Van", Vehicles: 4}, {Value: "Focus", Vehicles: 3}},
+				Year:     []yearCount{{Value: 2017, Vehicles: 3}, {Value: 2019, Vehicles: 10}, {Value: 2020, Vehicles: 4}},
+				Price: []priceBucket{
+					{Min: 10000, Max: price(20000), Cars: 1, Vehicles: 3},
+					{Min: 20000, Max: price(30000)},
+					{Min: 30000, Max: price(40000), Cars: 1, Vehicles: 10},
+					{Min: 40000, Max: price(50000), Cars: 1, Vehicles: 4},
+				},
+			},
+		},
+		{
+			name:       "DescendingEdges",
+			path:       "/cars/facets?price_buckets=40000,20000",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "EdgesAndWidth",
+			path:       "/cars/facets?price_buckets=20000&price_bucket_width=5000",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var result facets
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected: %+v, Got: %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPriceHistogram(t *testing.T) {
+	ts, _ := newTestServer(t, testCars)
+
+	price := func(p float32) *float32 {
+		return &p
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		expected   priceHistogram
+	}{
+		{
+			name:       "Width",
+			path:       "/cars/prices/histogram?make=Ford&price_bucket_width=15000",
+			statusCode: http.StatusOK,
+			expected: priceHistogram{
+				Mode: bucketsWidth, Cars: 3, Vehicles: 17, Lowest: 15000, Highest: 42000,
+				Buckets: []priceBucket{
+					{Min: 15000, Max: price(30000), Cars: 1, Vehicles: 3},
+					{Min: 30000, Max: price(45000), Cars: 2, Vehicles: 14},
+				},
+			},
+		},
+		{
+			name:       "Edges",
+			path:       "/cars/prices/histogram?price_buckets=0,20000",
+			statusCode: http.StatusOK,
+			expected: priceHistogram{
+				Mode: bucketsEdges, Cars: 5, Vehicles: 29, Lowest: 15000, Highest: 42000,
+				Buckets: []priceBucket{
+					{Min: 0, Max: price(20000), Cars: 2, Vehicles: 8},
+					{Min: 20000, Cars: 3, Vehicles: 21},
+				},
+			},
+		},
+		{
+			name:       "Quantile",
+			path:       "/cars/prices/histogram?price_quantiles=2",
+			statusCode: http.StatusOK,
+			expected: priceHistogram{
+				Mode: bucketsQuantile, Cars: 5, Vehicles: 29, Lowest: 15000, Highest: 42000,
+				Buckets: []priceBucket{
+					{Min: 15000, Max: price(21000), Cars: 2, Vehicles: 8},
+					{Min: 21000, Cars: 3, Vehicles: 21},
+				},
+			},
+		},
+		{
+			name:       "QuantileNoMatch",
+			path:       "/cars/prices/histogram?make=Volvo&price_quantiles=4",
+			statusCode: http.StatusOK,
+			expected:   priceHistogram{Mode: bucketsQuantile, Buckets: []priceBucket{}},
+		},
+		{
+			name:       "QuantileAndWidth",
+			path:       "/cars/prices/histogram?price_quantiles=4&price_bucket_width=5000",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "SingleQuantile",
+			path:       "/cars/prices/histogram?price_quantiles=1",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var result priceHistogram
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected: %+v, Got: %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPriceBucketsOverflow(t *testing.T) {
+	// A free car puts the cheapest bucket at 0
+	cars := append([]dal.Car(nil), testCars...)
+	cars[4].Price = 0
+	ts, _ := newTestServer(t, cars)
+
+	// Buckets this narrow put prices beyond any bucket index
+	for _, path := range []string{
+		"/cars/facets?price_bucket_width=1e-17",
+		"/cars/prices/histogram?price_bucket_width=1e-17",
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "overflowing the bucket index") {
+				t.Errorf("Expected status: %d with an overflow error, Got: %d %s", http.StatusBadRequest, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestGetAggregate(t *testing.T) {
+	// Prices this large are still written without an exponent
+	cars := append([]dal.Car(nil), testCars...)
+	cars[4].Price = 1500000
+	ts, _ := newTestServer(t, cars)
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		statusCode  int
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "JSON",
+			path:        "/cars/aggregate?group_by=make,year&metrics=count,avg_price&year_min=2019",
+			statusCode:  http.StatusOK,
+			contentType: "application/json",
+			expected: `{"columns":["make","year","count","avg_price"],"rows":[["Ford",2019,1,30000],["Ford",2020,1,42000],["Honda",2019,1,21000],["Kia",2020,1,1500000]]}
+`,
+		},
+		{
+			name:        "CSV",
+			path:        "/cars/aggregate?group_by=make&metrics=count,sum_vehicles,min_price,avg_price,median_price,weighted_median_price&format=csv",
+			statusCode:  http.StatusOK,
+			contentType: "text/csv",
+			expected: `make,count,sum_vehicles,min_price,avg_price,median_price,weighted_median_price
+Ford,3,17,15000,29000,30000,30000
+Honda,1,7,21000,21000,21000,21000
+Kia,1,5,1500000,1500000,1500000,1500000
+`,
+		},
+		{
+			name:        "AcceptCSV",
+			path:        "/cars/aggregate?metrics=count,sum_vehicles&make=Ford",
+			accept:      "text/csv, application/json;q=0.5",
+			statusCode:  http.StatusOK,
+			contentType: "text/csv",
+			expected: `count,sum_vehicles
+3,17
+`,
+		},
+		{
+			name:       "UnknownMetric",
+			path:       "/cars/aggregate?group_by=make&metrics=mode_price",
+			statusCode: http.StatusBadRequest,
+			expected:   "unknown metric: mode_price",
+		},
+		{
+			name:       "UnknownFormat",
+			path:       "/cars/aggregate?metrics=count&format=xml",
+			statusCode: http.StatusBadRequest,
+			expected:   "format must be json or csv: xml",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if contentType := resp.Header.Get("Content-Type"); tc.contentType != "" && contentType != tc.contentType {
+				t.Errorf("Expected Content-Type: %s, Got: %s", tc.contentType, contentType)
+			}
+			if string(body) != tc.expected {
+				t.Errorf("Expected: %q, Got: %q", tc.expected, body)
+			}
+		})
+	}
+}
+
+func TestGetAutocomplete(t *testing.T) {
+	ts, _ := newTestServer(t, testCars)
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		expected   completions
+	}{
+		{
+			name:       "Make",
+			path:       "/autocomplete?prefix=fo",
+			statusCode: http.StatusOK,
+			expected:   completions{Field: "make", Prefix: "fo", Completions: []dal.Completion{{Value: "Ford", Vehicles: 17}}},
+		},
+		{
+			name:       "ModelOfMake",
+			path:       "/autocomplete?field=model&make=ford&prefix=F",
+			statusCode: http.StatusOK,
+			expected: completions{Field: "model", Prefix: "F", Completions: []dal.Completion{
+				{Value: "F-150", Vehicles: 10},
+				{Value: "Focus", Vehicles: 3},
+			}},
+		},
+		{
+			name:       "UnknownMake",
+			path:       "/autocomplete?field=model&make=Volvo",
+			statusCode: http.StatusOK,
+			expected:   completions{Field: "model", Completions: []dal.Completion{}},
+		},
+		{
+			name:       "UnknownField",
+			path:       "/autocomplete?field=year",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "MakeOfMakes",
+			path:       "/autocomplete?field=make&make=Ford",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("Expected status: %d, Got: %d %s", tc.statusCode, resp.StatusCode, body)
+			}
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+
+			var result completions
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected: %+v, Got: %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetMakes(t *testing.T) {
+	// A model on sale over several years and a make with diacritics
+	cars := append(append([]dal.Car(nil), testCars...),
+		dal.Car{Make: "Ford", Model: "F-150", Year: 2021, VehicleCount: 2, Price: 38000},
+		dal.Car{Make: "Škoda", Model: "Octavia", Year: 2020, VehicleCount: 4, Price: 24000},
+	)
+	aliases, err := dal.NewAliasCatalog(dal.Aliases{Makes: map[string]string{"Blue Oval": "Ford"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, cars, WithAliases(aliases))
+
+	fordModels := makeModels{Make: "Ford", Models: []modelSummary{
+		{Model: "F-150", Vehicles: 12, Years: []int{2019, 2021}},
+		{Model: "Focus", Vehicles: 3, Years: []int{2017}},
+		{Model: "Transit Van", Vehicles: 4, Years: []int{2020}},
+	}}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		got        interface{}
+		expected   interface{}
+	}{
+		{
+			name:       "Makes",
+			path:       "/makes",
+			statusCode: http.StatusOK,
+			got:        &[]makeSummary{},
+			expected: &[]makeSummary{
+				{Make: "Ford", Vehicles: 19, Years: []int{2017, 2019, 2020, 2021}},
+				{Make: "Honda", Vehicles: 7, Years: []int{2019}},
+				{Make: "Kia", Vehicles: 5, Years: []int{2020}},
+				{Make: "Škoda", Vehicles: 4, Years: []int{2020}},
+			},
+		},
+		{
+			name:       "Models",
+			path:       "/makes/Ford/models",
+			statusCode: http.StatusOK,
+			got:        &makeModels{},
+			expected:   &fordModels,
+		},
+		{
+			name:       "FoldedMake",
+			path:       "/makes/skoda/models",
+			statusCode: http.StatusOK,
+			got:        &makeModels{},
+			expected:   &makeModels{Make: "Škoda", Models: []modelSummary{{Model: "Octavia", Vehicles: 4, Years: []int{2020}}}},
+		},
+		{
+			name:       "AliasedMake",
+			path:       "/makes/blue%20oval/models",
+			statusCode: http.StatusOK,
+			got:        &makeModels{},
+			expected:   &fordModels,
+		},
+		{
+			name:       "UnknownMake",
+			path:       "/makes/Volvo/models",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("Expected status: %d, Got: %d", tc.statusCode, resp.StatusCode)
+			}
+			if tc.got == nil {
+				return
+			}
+			if err := json.NewDecoder(resp.Body).Decode(tc.got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.got, tc.expected) {
+				t.Errorf("Expected: %+v, Got: %+v", tc.expected, tc.got)
+			}
+		})
+	}
+}
@@ -4,27 +4,129 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
 )
 
 // NewHTTPServer returns a new HTTP server
-func NewHTTPServer(addr string) *http.Server {
-	server := newHTTPServer()
-	r := mux.NewRouter()
-	r.HandleFunc("/cars", server.GetCars).Methods(http.MethodGet)
+func NewHTTPServer(addr string, opts ...Option) *http.Server {
+	server := newHTTPServer(opts...)
 	return &http.Server{
 		Addr:    addr,
-		Handler: r,
+		Handler: newRouter(server),
+	}
+}
+
+func newRouter(server *httpServer) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/cars", server.GetCars).Methods(http.MethodGet)
+	r.HandleFunc("/cars", server.CreateCar).Methods(http.MethodPost)
+	r.HandleFunc("/cars:bulk", server.BulkCars).Methods(http.MethodPost)
+	r.HandleFunc("/cars/search", server.SearchCars).Methods(http.MethodGet)
+	r.HandleFunc("/cars/facets", server.GetFacets).Methods(http.MethodGet)
+	r.HandleFunc("/cars/prices/histogram", server.GetPriceHistogram).Methods(http.MethodGet)
+	r.HandleFunc("/cars/aggregate", server.GetAggregate).Methods(http.MethodGet)
+	r.HandleFunc("/autocomplete", server.GetAutocomplete).Methods(http.MethodGet)
+	r.HandleFunc("/cars/{id:[0-9]+}", server.GetCar).Methods(http.MethodGet)
+	r.HandleFunc("/cars/{id:[0-9]+}", server.ReplaceCar).Methods(http.MethodPut)
+	r.HandleFunc("/cars/{id:[0-9]+}", server.PatchCar).Methods(http.MethodPatch)
+	r.HandleFunc("/cars/{id:[0-9]+}", server.DeleteCar).Methods(http.MethodDelete)
+	r.HandleFunc("/cars/{id:[0-9]+}/similar", server.GetSimilarCars).Methods(http.MethodGet)
+	r.HandleFunc("/makes", server.GetMakes).Methods(http.MethodGet)
+	r.HandleFunc("/makes/{make}/models", server.GetModels).Methods(http.MethodGet)
+	// The /admin endpoints are unauthenticated, for internal use only
+	r.HandleFunc("/admin/aliases", server.GetAliases).Methods(http.MethodGet)
+	r.HandleFunc("/admin/aliases/{kind:makes|models}/{alias}", server.SetAlias).Methods(http.MethodPut)
+	r.HandleFunc("/admin/aliases/{kind:makes|models}/{alias}", server.DeleteAlias).Methods(http.MethodDelete)
+	if server.reloader != nil {
+		r.HandleFunc("/admin/reload", server.Reload).Methods(http.MethodPost)
+		r.HandleFunc("/admin/reload", server.GetReloadStatus).Methods(http.MethodGet)
+	}
+	return r
+}
+
+// Option defines a functional option to configure the HTTP server
+type Option func(*httpServer)
+
+// WithStore sets the store the server reads cars from
+func WithStore(store dal.CarStore) Option {
+	return func(h *httpServer) {
+		h.store = store
+	}
+}
+
+// WithLogger sets the logger used by the server
+func WithLogger(logger *log.Logger) Option {
+	return func(h *httpServer) {
+		h.log = logger
+	}
+}
+
+// WithReloader enables the dataset reload admin endpoints
+func WithReloader(reloader *dal.Reloader) Option {
+	return func(h *httpServer) {
+		h.reloader = reloader
+	}
+}
+
+// WithRequestTimeout bounds how long a search may run, 0 leaves searches
+// bounded by the client only
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(h *httpServer) {
+		h.requestTimeout = timeout
+	}
+}
+
+// WithBudgetTolerance sets how far below and above the budget prices match
+// unless a search sets its own tolerance, as fractions of the budget between
+// 0 and 1
+func WithBudgetTolerance(under, over float64) Option {
+	return func(h *httpServer) {
+		h.budgetTolerance = budgetTolerance{under: under, over: over}
+	}
+}
+
+// WithRankWeights sets the weights of the budget closeness, year and
+// vehicles scores of balanced suggestion rankings unless a search sets its
+// own weights
+func WithRankWeights(budget, year, vehicles float64) Option {
+	return func(h *httpServer) {
+		h.rankWeights = rankWeights{budget: budget, year: year, vehicles: vehicles}
+	}
+}
+
+// WithAliases sets the catalog of make and model aliases searches are
+// mapped through
+func WithAliases(aliases *dal.AliasCatalog) Option {
+	return func(h *httpServer) {
+		h.aliases = aliases
 	}
 }
 
 type httpServer struct {
-	log *log.Logger
+	log             *log.Logger
+	store           dal.CarStore
+	reloader        *dal.Reloader
+	requestTimeout  time.Duration
+	budgetTolerance budgetTolerance
+	rankWeights     rankWeights
+	aliases         *dal.AliasCatalog
 }
 
-func newHTTPServer() *httpServer {
-	return &httpServer{
-		log: log.New(os.Stdout, "logs: ", log.LstdFlags),
+func newHTTPServer(opts ...Option) *httpServer {
+	server := &httpServer{
+		log:             log.New(os.Stdout, "logs: ", log.LstdFlags),
+		store:           dal.NewDefaultStore(),
+		budgetTolerance: defaultBudgetTolerance,
+		rankWeights:     defaultRankWeights,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	if server.aliases == nil {
+		server.aliases, _ = dal.NewAliasCatalog(dal.Aliases{})
 	}
+	return server
 }
@@ -6,13 +6,39 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
 )
 
+// testCars is the inventory the handler tests share, tests needing other
+// cars copy it and change what they assert on
+var testCars = []dal.Car{
+	{Make: "Ford", Model: "F-150", Year: 2019, VehicleCount: 10, Price: 30000},
+	{Make: "Ford", Model: "Transit Van", Year: 2020, VehicleCount: 4, Price: 42000},
+	{Make: "Honda", Model: "Civic", Year: 2019, VehicleCount: 7, Price: 21000},
+	{Make: "Ford", Model: "Focus", Year: 2017, VehicleCount: 3, Price: 15000},
+	{Make: "Kia", Model: "Soul", Year: 2020, VehicleCount: 5, Price: 18000},
+}
+
+// newTestServer returns a test server routing every handler over a store of
+// cars, closed when the test ends
+func newTestServer(t *testing.T, cars []dal.Car, opts ...Option) (*httptest.Server, *dal.MemoryStore) {
+	t.Helper()
+	store := dal.NewMemoryStore(cars)
+	opts = append([]Option{WithStore(store), WithLogger(log.New(io.Discard, "", 0))}, opts...)
+	ts := httptest.NewServer(newRouter(newHTTPServer(opts...)))
+	t.Cleanup(ts.Close)
+	return ts, store
+}
+
 func TestServer(t *testing.T) {
 
 	tests := []struct {
@@ -144,6 +170,56 @@ func TestErrorMessages(t *testing.T) {
 			// TODO: Need to properly handle this error message
 			expected: `strconv.ParseFloat: parsing "d3": invalid syntax`,
 		},
+		{
+			name:     "Incomplete query",
+			path:     "/cars?q=make:Ford+AND",
+			expected: "invalid q at position 14: unexpected end of query, expected a term",
+		},
+		{
+			name:     "Inverted year range",
+			path:     "/cars?year_min=2021&year_max=2018",
+			expected: "year_min must not be greater than year_max: 2021 > 2018",
+		},
+		{
+			name:     "Year range out of bounds",
+			path:     "/cars?year_min=19",
+			expected: "year_min must be between 1886 and 9999: 19",
+		},
+		{
+			name:     "Unknown match mode",
+			path:     "/cars?make=Ford&match=some",
+			expected: "match must be any or all: some",
+		},
+		{
+			name:     "Budget tolerance out of bounds",
+			path:     "/cars?budget=30000&budget_tolerance=1.5",
+			expected: "budget_tolerance must be between 0 and 1: 1.5",
+		},
+		{
+			name:     "Unknown stats mode",
+			path:     "/cars?make=Ford&stats=mean",
+			expected: "stats must be rows or weighted: mean",
+		},
+		{
+			name:     "Unknown rank strategy",
+			path:     "/cars?make=Ford&rank=popular",
+			expected: "rank must be cheapest, closest_to_budget, newest, most_available or balanced: popular",
+		},
+		{
+			name:     "Weight of an unweighted rank",
+			path:     "/cars?make=Ford&rank=newest&weight_year=2",
+			expected: "weight_year only applies to rank=balanced",
+		},
+		{
+			name:     "Suggestion limit out of bounds",
+			path:     "/cars?make=Ford&limit=0",
+			expected: "limit must be between 1 and 50: 0",
+		},
+		{
+			name:     "Invalid fuzzy flag",
+			path:     "/cars?make=Ford&fuzzy=maybe",
+			expected: "fuzzy must be true or false: maybe",
+		},
 	}
 
 	server := newHTTPServer()
@@ -175,3 +251,600 @@ func TestErrorMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestFixtureStore(t *testing.T) {
+	ts, _ := newTestServer(t, testCars[:3])
+
+	tests := []struct {
+		name     string
+		path     string
+		expected dal.CarResponse
+	}{
+		{
+			name: "MakeOnly",
+			path: "/cars?make=Ford",
+			expected: dal.CarResponse{
+				TotalVehicles:          14,
+				MakeModelTotalVehicles: 14,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+			},
+		},
+		{
+			name: "MakeModelYear",
+			path: "/cars?make=Ford&model=Van&year=2019",
+			expected: dal.CarResponse{
+				TotalVehicles:          21,
+				MakeModelTotalVehicles: 4,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+			},
+		},
+		{
+			name: "Query",
+			path: "/cars?q=" + url.QueryEscape("make:Ford AND NOT model:Van"),
+			expected: dal.CarResponse{
+				TotalVehicles:          10,
+				MakeModelTotalVehicles: 10,
+				Lowest:                 30000,
+				Median:                 30000,
+				Highest:                30000,
+				Suggestions: []dal.Car{
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+			},
+		},
+		{
+			name: "QueryAndFilters",
+			path: "/cars?year=2019&q=" + url.QueryEscape("price>20000 AND price<=42000"),
+			expected: dal.CarResponse{
+				TotalVehicles:          17,
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+			},
+		},
+		{
+			name: "Ranges",
+			path: "/cars?year_min=2018&year_max=2019&price_max=35000",
+			expected: dal.CarResponse{
+				TotalVehicles:          17,
+				MakeModelTotalVehicles: 17,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                30000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+			},
+		},
+		{
+			name: "MatchAll",
+			path: "/cars?make=Ford&model=Van&match=all",
+			expected: dal.CarResponse{
+				TotalVehicles:          4,
+				MakeModelTotalVehicles: 4,
+				Lowest:                 42000,
+				Median:                 42000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 2, Make: "Ford", Model: "Transit Van", Year: 2020, Price: 42000},
+				},
+				Match: "all",
+			},
+		},
+		{
+			name: "MatchAny",
+			path: "/cars?make=Ford&model=Van&budget=40000&match=any",
+			expected: dal.CarResponse{
+				TotalVehicles:          14,
+				MakeModelTotalVehicles: 4,
+				Lowest:                 30000,
+				Median:                 42000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				Match: "any",
+				BudgetWindow: &dal.BudgetWindow{
+					Under: 0.1,
+					Over:  0.1,
+					Min:   36000,
+					Max:   44000,
+				},
+			},
+		},
+		{
+			name: "NeverAboveBudget",
+			path: "/cars?budget=30000&budget_under=0.5&budget_over=0",
+			expected: dal.CarResponse{
+				TotalVehicles:          17,
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                30000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				BudgetWindow: &dal.BudgetWindow{
+					Under: 0.5,
+					Over:  0,
+					Min:   15000,
+					Max:   30000,
+				},
+			},
+		},
+		{
+			name: "FuzzyMake",
+			path: "/cars?make=frod&fuzzy=true",
+			expected: dal.CarResponse{
+				TotalVehicles:          14,
+				MakeModelTotalVehicles: 14,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				Resolved: map[string][]string{"make": {"Ford"}},
+			},
+		},
+		{
+			name: "FuzzyMakeModel",
+			path: "/cars?make=HONDA&model=civc&fuzzy=true&match=all",
+			expected: dal.CarResponse{
+				TotalVehicles:          7,
+				MakeModelTotalVehicles: 7,
+				Lowest:                 21000,
+				Median:                 21000,
+				Highest:                21000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+				},
+				Match:    "all",
+				Resolved: map[string][]string{"make": {"Honda"}, "model": {"Civic"}},
+			},
+		},
+		{
+			name: "DidYouMeanRelaxed",
+			path: "/cars?make=Ford&model=Transit&year=2019&match=all",
+			expected: dal.CarResponse{
+				MakeModelTotalVehicles: 4,
+				Match:                  "all",
+				DidYouMean: &dal.DidYouMean{
+					Relaxed: []dal.Relaxation{
+						{Without: "model", Vehicles: 10, Models: []string{"F-150"}},
+						{Without: "year", Vehicles: 4, Years: []int{2020}},
+					},
+				},
+			},
+		},
+		{
+			name: "DidYouMeanSpelling",
+			path: "/cars?make=frod&year=2019&match=all",
+			expected: dal.CarResponse{
+				Match: "all",
+				DidYouMean: &dal.DidYouMean{
+					Make: []string{"Ford"},
+					Relaxed: []dal.Relaxation{
+						{Without: "make", Vehicles: 17, Makes: []string{"Ford", "Honda"}},
+					},
+				},
+			},
+		},
+		{
+			name: "DidYouMeanAnyMatch",
+			path: "/cars?make=frod&year=2019",
+			expected: dal.CarResponse{
+				TotalVehicles: 17,
+				Lowest:        21000,
+				Median:        30000,
+				Highest:       42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				DidYouMean: &dal.DidYouMean{
+					Make: []string{"Ford"},
+					Relaxed: []dal.Relaxation{
+						{Without: "make", Vehicles: 17, Makes: []string{"Ford", "Honda"}},
+					},
+				},
+			},
+		},
+		{
+			name: "DidYouMeanBudget",
+			path: "/cars?make=Fo&budget=60000&match=all",
+			expected: dal.CarResponse{
+				MakeModelTotalVehicles: 14,
+				Match:                  "all",
+				BudgetWindow: &dal.BudgetWindow{
+					Under: 0.1,
+					Over:  0.1,
+					Min:   54000,
+					Max:   66000,
+				},
+				DidYouMean: &dal.DidYouMean{
+					Relaxed: []dal.Relaxation{
+						{Without: "budget", Vehicles: 14},
+					},
+					Budget: &dal.NearestBudget{
+						Budget:   42000,
+						Window:   dal.BudgetWindow{Under: 0.1, Over: 0.1, Min: 37800, Max: 46200},
+						Vehicles: 4,
+					},
+				},
+			},
+		},
+		{
+			name: "RankNewest",
+			path: "/cars?rank=newest",
+			expected: dal.CarResponse{
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 2, Make: "Ford", Model: "Transit Van", Year: 2020, Price: 42000},
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+				},
+				Rank: "newest",
+			},
+		},
+		{
+			name: "RankClosestToBudget",
+			path: "/cars?budget=40000&budget_tolerance=0.5&rank=closest_to_budget&limit=1",
+			expected: dal.CarResponse{
+				TotalVehicles:          21,
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 2, Make: "Ford", Model: "Transit Van", Year: 2020, Price: 42000},
+				},
+				Rank: "closest_to_budget",
+				BudgetWindow: &dal.BudgetWindow{
+					Under: 0.5,
+					Over:  0.5,
+					Min:   20000,
+					Max:   60000,
+				},
+			},
+		},
+		{
+			name: "RankBalancedWeights",
+			path: "/cars?rank=balanced&weight_budget=0&weight_year=1&weight_vehicles=2",
+			expected: dal.CarResponse{
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+				},
+				Rank: "balanced",
+			},
+		},
+		{
+			name: "WeightedStats",
+			path: "/cars?make=Ford&budget=30000&stats=weighted",
+			expected: dal.CarResponse{
+				TotalVehicles:          14,
+				MakeModelTotalVehicles: 14,
+				Lowest:                 30000,
+				Median:                 30000,
+				Highest:                30000,
+				Suggestions: []dal.Car{
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				BudgetWindow: &dal.BudgetWindow{
+					Under: 0.1,
+					Over:  0.1,
+					Min:   27000,
+					Max:   33000,
+				},
+				PriceStats: &dal.PriceStats{
+					Count:  10,
+					Cars:   1,
+					Mean:   30000,
+					P10:    30000,
+					P25:    30000,
+					Median: 30000,
+					P75:    30000,
+					P90:    30000,
+				},
+			},
+		},
+		{
+			name: "WeightedStatsFuzzy",
+			path: "/cars?make=frod&fuzzy=true&stats=weighted",
+			expected: dal.CarResponse{
+				TotalVehicles:          14,
+				MakeModelTotalVehicles: 14,
+				Lowest:                 30000,
+				Median:                 42000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				PriceStats: &dal.PriceStats{
+					Count:  14,
+					Cars:   2,
+					Mean:   33428.57142857143,
+					StdDev: 5421.047417431508,
+					P10:    30000,
+					P25:    30000,
+					Median: 30000,
+					P75:    42000,
+					P90:    42000,
+				},
+				Resolved: map[string][]string{"make": {"Ford"}},
+			},
+		},
+		{
+			name: "WeightedStatsEveryCar",
+			path: "/cars?stats=weighted",
+			expected: dal.CarResponse{
+				MakeModelTotalVehicles: 21,
+				Lowest:                 21000,
+				Median:                 30000,
+				Highest:                42000,
+				Suggestions: []dal.Car{
+					{ID: 3, Make: "Honda", Model: "Civic", Year: 2019, Price: 21000},
+					{ID: 1, Make: "Ford", Model: "F-150", Year: 2019, Price: 30000},
+				},
+				PriceStats: &dal.PriceStats{
+					Count:  21,
+					Cars:   3,
+					Mean:   29285.714285714286,
+					StdDev: 7342.912729083655,
+					P10:    21000,
+					P25:    21000,
+					Median: 30000,
+					P75:    30000,
+					P90:    42000,
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var carResp dal.CarResponse
+			resp, err := http.Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			err = json.NewDecoder(resp.Body).Decode(&carResp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(carResp, tc.expected) {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, carResp)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cars.csv")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("make,model,year,vehicle_count,price\nFord,F-150,2019,10,30000\n")
+
+	logger := log.New(io.Discard, "", 0)
+	store := dal.NewMemoryStore(nil)
+	reloader := dal.NewReloader(path, dal.LoadOptions{Strict: true}, store, logger)
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newHTTPServer(WithStore(store), WithReloader(reloader), WithLogger(logger))
+	ts := httptest.NewServer(newRouter(server))
+
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		content    string
+		statusCode int
+		records    int
+		hasError   bool
+	}{
+		{
+			name:       "Valid",
+			content:    "make,model,year,vehicle_count,price\nFord,F-150,2019,10,30000\nFord,Van,2020,4,42000\n",
+			statusCode: http.StatusOK,
+			records:    2,
+		},
+		{
+			name:       "Reordered",
+			content:    "make,model,year,vehicle_count,price\nKia,Soul,2020,3,18000\nFord,Van,2020,4,42000\nFord,F-150,2019,12,29000\n",
+			statusCode: http.StatusOK,
+			records:    3,
+		},
+		{
+			name:       "Malformed",
+			content:    "make,model,year,vehicle_count,price\nFord,F-150,2019,10,30000\nFord,Van,2020\n",
+			statusCode: http.StatusInternalServerError,
+			records:    3,
+			hasError:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			write(tc.content)
+
+			resp, err := http.Post(ts.URL+"/admin/reload", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var status dal.ReloadStatus
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("Expected status: %d, Got: %d", tc.statusCode, resp.StatusCode)
+			}
+			if status.Records != tc.records || store.Count() != tc.records {
+				t.Errorf("Expected %d records, Got: %d in status and %d in store", tc.records, status.Records, store.Count())
+			}
+			if (status.Error != "") != tc.hasError {
+				t.Errorf("Unexpected reload error: %q", status.Error)
+			}
+		})
+	}
+
+	// Cars keep their ID across reloads of a dataset without IDs
+	for id, model := range map[int]string{1: "F-150", 2: "Van", 3: "Soul"} {
+		if car, err := store.Get(id); err != nil || car.Model != model {
+			t.Errorf("Expected car %d to be the %s, Got: %v %v", id, model, car, err)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	cars := append([]dal.Car{{Make: "Chevrolet", Model: "Silverado", Year: 2019, VehicleCount: 6, Price: 35000}}, testCars...)
+	aliases, err := dal.LoadAliases(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := newTestServer(t, cars, WithAliases(aliases))
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	totalVehicles := func(path string) int {
+		resp := do(http.MethodGet, path, "")
+		defer resp.Body.Close()
+
+		var got dal.CarResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got.TotalVehicles
+	}
+
+	if got := totalVehicles("/cars?make=Chevy&model=F150&match=any"); got != 0 {
+		t.Errorf("Expected no vehicle before aliasing, Got: %d", got)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "SetMake", method: http.MethodPut, path: "/admin/aliases/makes/Chevy", body: `{"canonical": "Chevrolet"}`, statusCode: http.StatusOK},
+		{name: "SetModel", method: http.MethodPut, path: "/admin/aliases/models/F150", body: `{"canonical": "F-150"}`, statusCode: http.StatusOK},
+		{name: "EmptyCanonical", method: http.MethodPut, path: "/admin/aliases/makes/VW", body: `{"canonical": ""}`, statusCode: http.StatusBadRequest},
+		{name: "UnknownKind", method: http.MethodPut, path: "/admin/aliases/years/new", body: `{"canonical": "2020"}`, statusCode: http.StatusNotFound},
+		{name: "DeleteMissing", method: http.MethodDelete, path: "/admin/aliases/makes/VW", statusCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := do(tc.method, tc.path, tc.body)
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("Expected status: %d, Got: %d", tc.statusCode, resp.StatusCode)
+			}
+		})
+	}
+
+	if got := totalVehicles("/cars?make=chevy&model=f150&match=any"); got != 16 {
+		t.Errorf("Expected 16 vehicles once aliased, Got: %d", got)
+	}
+	if got := totalVehicles("/cars?q=" + url.QueryEscape("make:chevy OR model:F150")); got != 16 {
+		t.Errorf("Expected 16 vehicles for aliased query terms, Got: %d", got)
+	}
+
+	resp := do(http.MethodGet, "/admin/aliases", "")
+	defer resp.Body.Close()
+	var got dal.Aliases
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	expected := dal.Aliases{Makes: map[string]string{"Chevy": "Chevrolet"}, Models: map[string]string{"F150": "F-150"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected: %v, Got: %v", expected, got)
+	}
+
+	if resp := do(http.MethodDelete, "/admin/aliases/makes/CHEVY", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status: %d, Got: %d", http.StatusNoContent, resp.StatusCode)
+	}
+	if got := totalVehicles("/cars?make=Chevy"); got != 0 {
+		t.Errorf("Expected no vehicle once the alias is deleted, Got: %d", got)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	// Any deadline has passed by the time the search starts
+	ts, _ := newTestServer(t, testCars, WithRequestTimeout(time.Nanosecond))
+
+	for _, path := range []string{
+		"/cars?make=Ford&budget=30000",
+		"/cars/search?make=Ford",
+		"/cars/facets",
+		"/cars/prices/histogram",
+		"/cars/aggregate?group_by=make&metrics=count",
+		"/cars/1/similar",
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusGatewayTimeout {
+				t.Errorf("Expected status: %d, Got: %d %s", http.StatusGatewayTimeout, resp.StatusCode, body)
+			}
+			if expected := "search exceeded the 1ns request budget"; string(body) != expected {
+				t.Errorf("Expected: %v, Got: %v", expected, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
+)
+
+const (
+	// defaultSimilarCars is the number of similar cars unless set by a request
+	defaultSimilarCars = 10
+	// maxSimilarCars limits the number of similar cars of a response
+	maxSimilarCars = 50
+)
+
+// similarWeights defines the weight of each feature distance between cars
+type similarWeights struct {
+	price    float64
+	year     float64
+	affinity float64
+	vehicles float64
+}
+
+// defaultSimilarWeights favours price, year and make and model over
+// availability
+var defaultSimilarWeights = similarWeights{price: 1, year: 1, affinity: 1, vehicles: 0.5}
+
+// similarCar defines a car along with its distance to the car it is similar
+// to, 0 being identical
+type similarCar struct {
+	carRecord
+	Distance float64 `json:"distance"`
+}
+
+// similarCars defines a car and the cars most similar to it, nearest first
+type similarCars struct {
+	Car     carRecord    `json:"car"`
+	Similar []similarCar `json:"similar"`
+}
+
+// GetSimilarCars defines a GET handler listing the cars nearest to a car.
+// Cars are compared by price, year, make and model, and number of vehicles,
+// each distance normalized over the inventory.
+func (h *httpServer) GetSimilarCars(w http.ResponseWriter, r *http.Request) {
+	vars := r.URL.Query()
+
+	id, err := carID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	weights, err := parseSimilarWeights(vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseLimit(vars, defaultSimilarCars, maxSimilarCars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var excludeSameMake bool
+	if value := vars.Get("exclude_same_make"); value != "" {
+		excludeSameMake, err = strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("exclude_same_make must be true or false: %s", value))
+			return
+		}
+	}
+
+	ctx, cancel := h.searchContext(r)
+	defer cancel()
+
+	car, err := h.store.Get(id)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+
+	// The nearest cars are kept in a max-heap of limit cars
+	snap := h.store.Snapshot()
+	done := ctx.Done()
+	distance := newFeatureSpace(snap.Cars, weights)
+	distances := make([]float64, len(snap.Cars))
+	nearest := newTopK(limit, func(a, b int) bool {
+		if distances[a] != distances[b] {
+			return distances[a] < distances[b]
+		}
+		return snap.Cars[a].ID < snap.Cars[b].ID
+	})
+	for i, other := range snap.Cars {
+		if cancelled(done) {
+			h.writeProcessorError(w, r, ctx.Err())
+			return
+		}
+		if other.ID == car.ID || excludeSameMake && other.Make == car.Make {
+			continue
+		}
+		distances[i] = distance(car, other)
+		nearest.offer(i)
+	}
+
+	result := similarCars{Car: newCarRecord(car), Similar: []similarCar{}}
+	for _, i := range nearest.sorted() {
+		result.Similar = append(result.Similar, similarCar{carRecord: newCarRecord(snap.Cars[i]), Distance: distances[i]})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// newFeatureSpace returns the distance between two cars, the weighted
+// euclidean distance of their price, year, affinity and vehicles distances.
+// Numeric distances are scaled to the range of the cars, the affinity
+// distance is 0 for the same make and model, 0.5 for the same make and 1
+// otherwise.
+func newFeatureSpace(cars []dal.Car, weights similarWeights) func(a, b dal.Car) float64 {
+	var minPrice, maxPrice float32
+	var minYear, maxYear, minVehicles, maxVehicles int
+	for i, car := range cars {
+		if i == 0 || car.Price < minPrice {
+			minPrice = car.Price
+		}
+		if i == 0 || car.Price > maxPrice {
+			maxPrice = car.Price
+		}
+		if i == 0 || car.Year < minYear {
+			minYear = car.Year
+		}
+		if i == 0 || car.Year > maxYear {
+			maxYear = car.Year
+		}
+		if i == 0 || car.VehicleCount < minVehicles {
+			minVehicles = car.VehicleCount
+		}
+		if i == 0 || car.VehicleCount > maxVehicles {
+			maxVehicles = car.VehicleCount
+		}
+	}
+	// scaled returns the distance of a and b as a share of the range
+	scaled := func(a, b, low, high float64) float64 {
+		if high <= low {
+			return 0
+		}
+		return math.Abs(a-b) / (high - low)
+	}
+
+	return func(a, b dal.Car) float64 {
+		price := scaled(float64(a.Price), float64(b.Price), float64(minPrice), float64(maxPrice))
+		year := scaled(float64(a.Year), float64(b.Year), float64(minYear), float64(maxYear))
+		vehicles := scaled(float64(a.VehicleCount), float64(b.VehicleCount), float64(minVehicles), float64(maxVehicles))
+		affinity := 1.0
+		switch {
+		case a.Make == b.Make && a.Model == b.Model:
+			affinity = 0
+		case a.Make == b.Make:
+			affinity = 0.5
+		}
+		return math.Sqrt(weights.price*price*price +
+			weights.year*year*year +
+			weights.affinity*affinity*affinity +
+			weights.vehicles*vehicles*vehicles)
+	}
+}
+
+// parseSimilarWeights returns the feature weights of a request, the
+// weight_price, weight_year, weight_affinity and weight_vehicles parameters
+// override the defaults
+func parseSimilarWeights(vars url.Values) (similarWeights, error) {
+	weights := defaultSimilarWeights
+	for _, param := range []struct {
+		name  string
+		field *float64
+	}{
+		{name: "weight_price", field: &weights.price},
+		{name: "weight_year", field: &weights.year},
+		{name: "weight_affinity", field: &weights.affinity},
+		{name: "weight_vehicles", field: &weights.vehicles},
+	} {
+		value := vars.Get(param.name)
+		if value == "" {
+			continue
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(weight >= 0) || math.IsInf(weight, 0) {
+			return weights, fmt.Errorf("%s must be a non-negative number: %s", param.name, value)
+		}
+		*param.field = weight
+	}
+	if weights.price+weights.year+weights.affinity+weights.vehicles <= 0 {
+		return weights, errors.New("at least one of weight_price, weight_year, weight_affinity and weight_vehicles must be positive")
+	}
+	return weights, nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Price stats modes of a search
+const (
+	// statsRows computes the lowest, median and highest prices over the
+	// cars, whatever their number of vehicles
+	statsRows = "rows"
+	// statsWeighted adds the price stats weighted by the number of vehicles
+	// of the cars matching every filter
+	statsWeighted = "weighted"
+)
+
+func validateStats(vars url.Values) (string, error) {
+	stats := vars.Get("stats")
+	switch stats {
+	case "", statsRows, statsWeighted:
+		return stats, nil
+	}
+	return "", fmt.Errorf("stats must be %s or %s: %s", statsRows, statsWeighted, stats)
+}
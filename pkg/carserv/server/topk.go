@@ -0,0 +1,46 @@
+package server
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// topK keeps the k least items offered to it, by less, in a max-heap so that
+// each offer costs O(log k) rather than sorting every item
+type topK struct {
+	k     int
+	items []int
+	less  func(a, b int) bool
+}
+
+func newTopK(k int, less func(a, b int) bool) *topK {
+	return &topK{k: k, less: less}
+}
+
+// offer keeps item when it is among the k least items offered so far
+func (t *topK) offer(item int) {
+	if len(t.items) < t.k {
+		heap.Push(t, item)
+		return
+	}
+	if t.k > 0 && t.less(item, t.items[0]) {
+		t.items[0] = item
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the kept items, least first
+func (t *topK) sorted() []int {
+	sort.Slice(t.items, func(a, b int) bool { return t.less(t.items[a], t.items[b]) })
+	return t.items
+}
+
+func (t *topK) Len() int           { return len(t.items) }
+func (t *topK) Less(a, b int) bool { return t.less(t.items[b], t.items[a]) }
+func (t *topK) Swap(a, b int)      { t.items[a], t.items[b] = t.items[b], t.items[a] }
+func (t *topK) Push(x interface{}) { t.items = append(t.items, x.(int)) }
+func (t *topK) Pop() interface{} {
+	last := t.items[len(t.items)-1]
+	t.items = t.items[:len(t.items)-1]
+	return last
+}
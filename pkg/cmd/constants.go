@@ -12,4 +12,42 @@ const (
 	ServeCmdName  = "serve"
 	ServeCmdShort = ""
 	ServeCmdLong  = ""
+
+	DatasetFlag                 = "dataset"
+	DatasetFlagUsage            = "path to a CSV, JSON or NDJSON dataset file, defaults to the built-in dataset"
+	DatasetFormatFlag           = "dataset-format"
+	DatasetFormatFlagUsage      = "dataset file format (csv, json or ndjson), detected from the file extension when empty"
+	DatasetModeFlag             = "dataset-mode"
+	DatasetModeFlagUsage        = "how malformed dataset rows are handled: strict rejects the file, lenient skips the rows"
+	ReloadIntervalFlag          = "reload-interval"
+	ReloadIntervalFlagUsage     = "how often the dataset file is checked for changes, 0 disables polling"
+	DataDirFlag                 = "data-dir"
+	DataDirFlagUsage            = "directory persisting the inventory, seeded from the dataset when empty; disables dataset reloads"
+	FsyncFlag                   = "fsync"
+	FsyncFlagUsage              = "when the write-ahead log is flushed to disk: always, interval or never"
+	FsyncIntervalFlag           = "fsync-interval"
+	FsyncIntervalFlagUsage      = "how often the write-ahead log is flushed with --fsync=interval"
+	CompactAfterFlag            = "compact-after"
+	CompactAfterFlagUsage       = "number of logged writes after which the write-ahead log is compacted into a snapshot, 0 compacts on shutdown only"
+	RequestTimeoutFlag          = "request-timeout"
+	RequestTimeoutFlagUsage     = "how long a search may run before it is answered with 504 Gateway Timeout, 0 disables the limit"
+	BudgetToleranceFlag         = "budget-tolerance"
+	BudgetToleranceFlagUsage    = "fraction of the budget prices may be below or above it and still match, between 0 and 1"
+	BudgetUnderFlag             = "budget-under"
+	BudgetUnderFlagUsage        = "fraction of the budget prices may be below it and still match, defaults to --budget-tolerance"
+	BudgetOverFlag              = "budget-over"
+	BudgetOverFlagUsage         = "fraction of the budget prices may be above it and still match, defaults to --budget-tolerance"
+	RankBudgetWeightFlag        = "rank-budget-weight"
+	RankBudgetWeightFlagUsage   = "weight of the budget closeness of cars in balanced suggestion rankings"
+	RankYearWeightFlag          = "rank-year-weight"
+	RankYearWeightFlagUsage     = "weight of the year of cars in balanced suggestion rankings"
+	RankVehiclesWeightFlag      = "rank-vehicles-weight"
+	RankVehiclesWeightFlagUsage = "weight of the number of vehicles of cars in balanced suggestion rankings"
+	AliasesFlag                 = "aliases"
+	AliasesFlagUsage            = "path to a JSON file of make and model aliases, created by the first alias edit when missing"
+	ConfigFlag                  = "config"
+	ConfigFlagUsage             = "path to a YAML, JSON or TOML config file setting any serve flag by name"
+
+	DatasetModeStrict  = "strict"
+	DatasetModeLenient = "lenient"
 )
@@ -1,15 +1,26 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/nekruzvatanshoev/carserv/pkg/carserv/dal"
 	"github.com/nekruzvatanshoev/carserv/pkg/carserv/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// shutdownTimeout bounds how long in-flight requests are waited for on shutdown
+const shutdownTimeout = 10 * time.Second
+
 var RootCmd = &cobra.Command{
 	Use:   RootCmdName,
 	Short: RootCmdShort,
@@ -24,7 +35,25 @@ func Execute() {
 }
 
 func init() {
+	cobra.OnInitialize(readConfig)
+	RootCmd.PersistentFlags().String(ConfigFlag, "", ConfigFlagUsage)
 	RootCmd.AddCommand(ServeCmd)
+	ServeCmd.Flags().String(DatasetFlag, "", DatasetFlagUsage)
+	ServeCmd.Flags().String(DatasetFormatFlag, "", DatasetFormatFlagUsage)
+	ServeCmd.Flags().String(DatasetModeFlag, DatasetModeStrict, DatasetModeFlagUsage)
+	ServeCmd.Flags().Duration(ReloadIntervalFlag, 30*time.Second, ReloadIntervalFlagUsage)
+	ServeCmd.Flags().String(DataDirFlag, "", DataDirFlagUsage)
+	ServeCmd.Flags().String(FsyncFlag, string(dal.SyncInterval), FsyncFlagUsage)
+	ServeCmd.Flags().Duration(FsyncIntervalFlag, time.Second, FsyncIntervalFlagUsage)
+	ServeCmd.Flags().Int(CompactAfterFlag, 10000, CompactAfterFlagUsage)
+	ServeCmd.Flags().Duration(RequestTimeoutFlag, 5*time.Second, RequestTimeoutFlagUsage)
+	ServeCmd.Flags().Float64(BudgetToleranceFlag, 0.10, BudgetToleranceFlagUsage)
+	ServeCmd.Flags().Float64(BudgetUnderFlag, 0.10, BudgetUnderFlagUsage)
+	ServeCmd.Flags().Float64(BudgetOverFlag, 0.10, BudgetOverFlagUsage)
+	ServeCmd.Flags().Float64(RankBudgetWeightFlag, 0.5, RankBudgetWeightFlagUsage)
+	ServeCmd.Flags().Float64(RankYearWeightFlag, 0.25, RankYearWeightFlagUsage)
+	ServeCmd.Flags().Float64(RankVehiclesWeightFlag, 0.25, RankVehiclesWeightFlagUsage)
+	ServeCmd.Flags().String(AliasesFlag, "", AliasesFlagUsage)
 	viper.BindPFlags(ServeCmd.Flags())
 }
 
@@ -47,7 +76,44 @@ func serveCmdFunc() func(cmd *cobra.Command, args []string) {
 			addr = ":8080"
 		}
 
-		serve := server.NewHTTPServer(addr)
+		store, reloader, err := loadStore()
+		if err != nil {
+			log.Fatalf("Failed to load the dataset: %v", err)
+		}
+
+		under, over, err := budgetTolerance()
+		if err != nil {
+			log.Fatalf("Invalid budget tolerance: %v", err)
+		}
+
+		budgetWeight, yearWeight, vehiclesWeight, err := rankWeights()
+		if err != nil {
+			log.Fatalf("Invalid rank weights: %v", err)
+		}
+
+		aliases, err := dal.NewAliasCatalog(dal.Aliases{})
+		if path := viper.GetString(AliasesFlag); path != "" {
+			aliases, err = dal.LoadAliases(path)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load the aliases: %v", err)
+		}
+
+		opts := []server.Option{
+			server.WithStore(store),
+			server.WithAliases(aliases),
+			server.WithRequestTimeout(viper.GetDuration(RequestTimeoutFlag)),
+			server.WithBudgetTolerance(under, over),
+			server.WithRankWeights(budgetWeight, yearWeight, vehiclesWeight),
+		}
+		done := make(chan struct{})
+		defer close(done)
+		if reloader != nil {
+			opts = append(opts, server.WithReloader(reloader))
+			watchDataset(done, reloader)
+		}
+
+		serve := server.NewHTTPServer(addr, opts...)
 
 		signalCh := make(chan os.Signal, 1)
 
@@ -59,10 +125,178 @@ func serveCmdFunc() func(cmd *cobra.Command, args []string) {
 			}
 		}()
 
-		signal.Notify(signalCh, os.Interrupt)
+		signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 
 		sig := <-signalCh
 
 		log.Printf("Shutdown the server...%s", sig.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := serve.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shutdown the server gracefully: %v", err)
+		}
+		if closer, ok := store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Failed to close the store: %v", err)
+			}
+		}
 	}
 }
+
+// loadStore returns the store serving the inventory. With a data directory
+// the inventory is persisted there, otherwise the dataset file given by the
+// dataset flag is served along with its reloader, or the built-in dataset
+// when no file is given.
+func loadStore() (dal.CarStore, *dal.Reloader, error) {
+	path := viper.GetString(DatasetFlag)
+	if dir := viper.GetString(DataDirFlag); dir != "" {
+		store, err := openFileStore(dir, path)
+		return store, nil, err
+	}
+
+	if path == "" {
+		return dal.NewDefaultStore(), nil, nil
+	}
+
+	opts, err := loadOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store := dal.NewMemoryStore(nil)
+	reloader := dal.NewReloader(path, opts, store, log.New(os.Stdout, "", log.LstdFlags))
+	if _, err := reloader.Reload(); err != nil {
+		return nil, nil, err
+	}
+	return store, reloader, nil
+}
+
+// openFileStore opens the store persisted in dir, the dataset file at path
+// or the built-in dataset seeds a new store
+func openFileStore(dir, path string) (*dal.FileStore, error) {
+	policy, err := dal.ParseSyncPolicy(viper.GetString(FsyncFlag))
+	if err != nil {
+		return nil, err
+	}
+	storeOpts := dal.FileStoreOptions{
+		Sync:         policy,
+		SyncInterval: viper.GetDuration(FsyncIntervalFlag),
+		CompactAfter: viper.GetInt(CompactAfterFlag),
+	}
+
+	seed := dal.CarsDataset
+	if path != "" {
+		opts, err := loadOptions()
+		if err != nil {
+			return nil, err
+		}
+		var rowErrs []*dal.RowError
+		seed, rowErrs, err = dal.LoadFile(path, opts)
+		for _, rowErr := range rowErrs {
+			log.Printf("Malformed dataset row in %s: %v", path, rowErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Dataset %s only seeds an empty data directory and is not reloaded", path)
+	}
+
+	return dal.OpenFileStore(dir, seed, storeOpts, log.New(os.Stdout, "", log.LstdFlags))
+}
+
+// watchDataset reloads the dataset on SIGHUP and, unless polling is
+// disabled, whenever the dataset file changes
+func watchDataset(done <-chan struct{}, reloader *dal.Reloader) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-done:
+				signal.Stop(hupCh)
+				return
+			case <-hupCh:
+				log.Println("Received SIGHUP, reloading the dataset")
+				reloader.Reload()
+			}
+		}
+	}()
+
+	if interval := viper.GetDuration(ReloadIntervalFlag); interval > 0 {
+		go reloader.Watch(done, interval)
+	}
+}
+
+// readConfig reads the config file given by the config flag, if any
+func readConfig() {
+	path, _ := RootCmd.PersistentFlags().GetString(ConfigFlag)
+	if path == "" {
+		return
+	}
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("Failed to read the config file: %v", err)
+	}
+}
+
+// budgetTolerance returns the fractions of the budget prices may be below
+// and above it, budget-under and budget-over override budget-tolerance
+func budgetTolerance() (float64, float64, error) {
+	under := viper.GetFloat64(BudgetToleranceFlag)
+	over := under
+	if viper.IsSet(BudgetUnderFlag) {
+		under = viper.GetFloat64(BudgetUnderFlag)
+	}
+	if viper.IsSet(BudgetOverFlag) {
+		over = viper.GetFloat64(BudgetOverFlag)
+	}
+
+	for _, fraction := range []float64{under, over} {
+		if fraction < 0 || fraction > 1 {
+			return 0, 0, fmt.Errorf("fractions of the budget must be between 0 and 1: %v", fraction)
+		}
+	}
+	return under, over, nil
+}
+
+// rankWeights returns the weights of the budget closeness, year and vehicles
+// of cars in balanced suggestion rankings
+func rankWeights() (float64, float64, float64, error) {
+	budget := viper.GetFloat64(RankBudgetWeightFlag)
+	year := viper.GetFloat64(RankYearWeightFlag)
+	vehicles := viper.GetFloat64(RankVehiclesWeightFlag)
+
+	for _, weight := range []float64{budget, year, vehicles} {
+		if !(weight >= 0) || math.IsInf(weight, 0) {
+			return 0, 0, 0, fmt.Errorf("rank weights must be non-negative numbers: %v", weight)
+		}
+	}
+	if budget+year+vehicles <= 0 {
+		return 0, 0, 0, errors.New("at least one rank weight must be positive")
+	}
+	return budget, year, vehicles, nil
+}
+
+func loadOptions() (dal.LoadOptions, error) {
+	var opts dal.LoadOptions
+
+	if format := viper.GetString(DatasetFormatFlag); format != "" {
+		f, err := dal.ParseFormat(format)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = f
+	}
+
+	switch mode := viper.GetString(DatasetModeFlag); mode {
+	case DatasetModeStrict:
+		opts.Strict = true
+	case DatasetModeLenient:
+		opts.Strict = false
+	default:
+		return opts, fmt.Errorf("unknown dataset mode: %s", mode)
+	}
+
+	return opts, nil
+}